@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	bv "github.com/Yuelioi/bilibili/pkg/endpoints/video"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+)
+
+const healthService = "health_check"
+
+// 导航栏用户信息
+type navData struct {
+	IsLogin    bool   `json:"isLogin"`
+	Mid        int    `json:"mid"`
+	Uname      string `json:"uname"`
+	VipStatus  int    `json:"vipStatus"`  // 1:有效
+	VipType    int    `json:"vipType"`    // 1:月度 2:年度
+	VipDueDate int64  `json:"vipDueDate"` // 毫秒
+	VipLabel   struct {
+		Text string `json:"text"`
+	} `json:"vip_label"`
+}
+
+// 账号状态, 更新设置时校验
+type accountStatus struct {
+	name       string
+	mid        int
+	vip        bool
+	vipLabel   string
+	vipExpire  time.Time
+	maxQuality int // 可用的最高清晰度
+}
+
+// 获取登录信息, 未登录时接口返回 -101
+func fetchNav(sessdata string) (*navData, error) {
+	resp, err := newRequest(sessdata).Get(apiBase + "/x/web-interface/nav")
+	if err != nil {
+		return nil, err
+	}
+
+	nav, err := decodeAPI[navData](resp, -101)
+	if err != nil {
+		return nil, err
+	}
+	return &nav.Data, nil
+}
+
+func (n *navData) vipActive(now time.Time) bool {
+	return n.VipStatus == 1 && time.UnixMilli(n.VipDueDate).After(now)
+}
+
+// 未登录 480P, 登录 1080P, 大会员 8K
+func (n *navData) maxQuality(now time.Time) int {
+	switch {
+	case !n.IsLogin:
+		return 32
+	case n.vipActive(now):
+		return 127
+	default:
+		return 80
+	}
+}
+
+func (n *navData) status(now time.Time) *accountStatus {
+	return &accountStatus{
+		name:       n.Uname,
+		mid:        n.Mid,
+		vip:        n.vipActive(now),
+		vipLabel:   n.VipLabel.Text,
+		vipExpire:  time.UnixMilli(n.VipDueDate),
+		maxQuality: n.maxQuality(now),
+	}
+}
+
+func (a *accountStatus) String() string {
+	if a.mid == 0 {
+		return "未登录, 最高清晰度 " + bv.VideoQualityMap[a.maxQuality]
+	}
+	s := fmt.Sprintf("%s(%d)", a.name, a.mid)
+	if a.vip {
+		s += fmt.Sprintf(" %s 到期 %s", a.vipLabel, a.vipExpire.Format(time.DateOnly))
+	}
+	return s + ", 最高清晰度 " + bv.VideoQualityMap[a.maxQuality]
+}
+
+// 返回给宿主的账号信息, 通过 Update 的响应头传递
+func (a *accountStatus) metadata() metadata.MD {
+	md := metadata.Pairs(
+		"account-name", a.name,
+		"account-mid", strconv.Itoa(a.mid),
+		"account-vip", strconv.FormatBool(a.vip),
+		"account-max-quality", strconv.Itoa(a.maxQuality),
+	)
+	if a.vip {
+		md.Set("account-vip-label", a.vipLabel)
+		md.Set("account-vip-expire", a.vipExpire.Format(time.DateOnly))
+	}
+	return md
+}
+
+// 校验 SESSDATA, 失效时健康检查返回 NOT_SERVING
+// 网络错误时无法判断登录状态, 返回 nil 并保持当前状态
+func (s *server) checkAccount(sessdata string) *accountStatus {
+	if sessdata == "" {
+		return s.setAccount(&accountStatus{maxQuality: 32}, "")
+	}
+
+	nav, err := fetchNav(sessdata)
+	if err != nil {
+		fmt.Printf("校验登录状态失败, err: %s\n", err.Error())
+		return nil
+	}
+	if !nav.IsLogin {
+		return s.setAccount(nav.status(time.Now()), "SESSDATA 已失效, 请重新登录")
+	}
+	return s.setAccount(nav.status(time.Now()), "")
+}
+
+func (s *server) setAccount(account *accountStatus, reason string) *accountStatus {
+	fmt.Printf("账号: %s\n", account)
+	if s.health != nil {
+		s.health.setReason(reason)
+	}
+	return account
+}
+
+// 健康检查, 不可用时在响应头中附带原因
+type healthServer struct {
+	*health.Server
+	mu     sync.Mutex
+	reason string
+}
+
+func newHealthServer() *healthServer {
+	h := &healthServer{Server: health.NewServer()}
+	h.SetServingStatus(healthService, grpc_health_v1.HealthCheckResponse_SERVING)
+	return h
+}
+
+func (h *healthServer) setReason(reason string) {
+	h.mu.Lock()
+	h.reason = reason
+	h.mu.Unlock()
+
+	if reason == "" {
+		h.SetServingStatus(healthService, grpc_health_v1.HealthCheckResponse_SERVING)
+	} else {
+		h.SetServingStatus(healthService, grpc_health_v1.HealthCheckResponse_NOT_SERVING)
+	}
+}
+
+func (h *healthServer) Check(ctx context.Context, req *grpc_health_v1.HealthCheckRequest) (*grpc_health_v1.HealthCheckResponse, error) {
+	h.mu.Lock()
+	reason := h.reason
+	h.mu.Unlock()
+
+	if reason != "" {
+		grpc.SetHeader(ctx, metadata.Pairs("reason", reason))
+	}
+	return h.Server.Check(ctx, req)
+}
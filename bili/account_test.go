@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func TestNavStatus(t *testing.T) {
+	now := time.Date(2024, 10, 1, 0, 0, 0, 0, time.Local)
+	data := `{"isLogin": true, "mid": 1, "uname": "测试", "vipStatus": 1, "vipType": 2,
+		"vipDueDate": 1735660800000, "vip_label": {"text": "年度大会员"}}`
+
+	var nav navData
+	if err := json.Unmarshal([]byte(data), &nav); err != nil {
+		t.Fatal(err)
+	}
+
+	account := nav.status(now)
+	if !account.vip || account.maxQuality != 127 || account.name != "测试" {
+		t.Errorf("unexpected account: %+v", account)
+	}
+
+	// 大会员过期后只能使用 1080P
+	if q := nav.maxQuality(time.UnixMilli(nav.VipDueDate).Add(time.Hour)); q != 80 {
+		t.Errorf("got quality %d after expiry, want 80", q)
+	}
+
+	md := account.metadata()
+	if md.Get("account-name")[0] != "测试" || md.Get("account-max-quality")[0] != "127" || md.Get("account-vip-expire")[0] != time.UnixMilli(nav.VipDueDate).Format(time.DateOnly) {
+		t.Errorf("unexpected metadata: %v", md)
+	}
+
+	nav.IsLogin = false
+	if q := nav.maxQuality(now); q != 32 {
+		t.Errorf("got quality %d when logged out, want 32", q)
+	}
+}
+
+func TestHealthReason(t *testing.T) {
+	h := newHealthServer()
+	req := &grpc_health_v1.HealthCheckRequest{Service: healthService}
+
+	h.setReason("SESSDATA 已失效")
+	resp, err := h.Check(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Status != grpc_health_v1.HealthCheckResponse_NOT_SERVING {
+		t.Errorf("got %s, want NOT_SERVING", resp.Status)
+	}
+
+	h.setReason("")
+	if resp, _ := h.Check(context.Background(), req); resp.Status != grpc_health_v1.HealthCheckResponse_SERVING {
+		t.Errorf("got %s, want SERVING", resp.Status)
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"errors"
+	"strings"
+)
+
+// 未指定账号时使用 SESSDATA 设置
+const defaultAccount = "default"
+
+type account struct {
+	name     string
+	sessdata string
+	biliJct  string
+}
+
+// 解析账号池 e.g. vip:SESSDATA:bili_jct,me:SESSDATA
+// SESSDATA 中的逗号已经过 URL 编码
+func parseAccounts(v string) []account {
+	accounts := make([]account, 0)
+	for _, item := range splitList(v) {
+		parts := strings.SplitN(item, ":", 3)
+		if len(parts) < 2 || parts[0] == "" || parts[1] == "" {
+			continue
+		}
+
+		acc := account{name: parts[0], sessdata: parts[1]}
+		if len(parts) == 3 {
+			acc.biliJct = parts[2]
+		}
+		accounts = append(accounts, acc)
+	}
+	return accounts
+}
+
+// 按使用顺序排列的账号, 指定的账号在前, 其余作为失败时的备选
+func (c *Config) accountsFor(name string) []account {
+	all := make([]account, 0, len(c.accounts)+1)
+	if c.sessdata != "" {
+		all = append(all, account{name: defaultAccount, sessdata: c.sessdata, biliJct: c.biliJct})
+	}
+	all = append(all, c.accounts...)
+
+	ordered := make([]account, 0, len(all))
+	for _, acc := range all {
+		if acc.name == name {
+			ordered = append(ordered, acc)
+		}
+	}
+	for _, acc := range all {
+		if acc.name != name {
+			ordered = append(ordered, acc)
+		}
+	}
+
+	// 没有配置账号时以游客身份请求
+	if len(ordered) == 0 {
+		ordered = append(ordered, account{name: defaultAccount})
+	}
+	return ordered
+}
+
+// 使用指定账号的配置副本
+func (c *Config) withAccount(acc account) *Config {
+	copied := *c
+	copied.sessdata = acc.sessdata
+	copied.biliJct = acc.biliJct
+	return &copied
+}
+
+// 风控或登录失效时可以换用其他账号
+// 未购买, 需要大会员等权限错误与账号状态无关, 直接返回
+func isAccountError(err error) bool {
+	var apiErr *apiError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	switch apiErr.code {
+	case -101, -352, -412, -509:
+		return true
+	}
+	return false
+}
+
+// 依次使用账号请求, 遇到账号相关的错误时换用下一个
+// 全部失败时返回第一个账号的错误, 即任务指定账号的错误
+func withAccounts[T any](accounts []account, fn func(acc account) (T, error)) (T, account, error) {
+	var result T
+	var firstErr error
+	for _, acc := range accounts {
+		res, err := fn(acc)
+		if err == nil || !isAccountError(err) {
+			return res, acc, err
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	return result, account{}, firstErr
+}
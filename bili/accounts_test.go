@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestAccountsFor(t *testing.T) {
+	c := NewConfig()
+	c.sessdata = "main"
+	c.accounts = parseAccounts("vip:vip%2Csess:jct, broken, me:mine")
+
+	if len(c.accounts) != 2 || c.accounts[0].biliJct != "jct" || c.accounts[1].sessdata != "mine" {
+		t.Fatalf("unexpected accounts: %+v", c.accounts)
+	}
+
+	names := func(accounts []account) []string {
+		out := make([]string, 0, len(accounts))
+		for _, acc := range accounts {
+			out = append(out, acc.name)
+		}
+		return out
+	}
+
+	cases := map[string][]string{
+		"":        {defaultAccount, "vip", "me"},
+		"me":      {"me", defaultAccount, "vip"},
+		"unknown": {defaultAccount, "vip", "me"},
+	}
+	for name, want := range cases {
+		got := names(c.accountsFor(name))
+		if len(got) != len(want) {
+			t.Errorf("%q: got %v, want %v", name, got, want)
+			continue
+		}
+		for i := range got {
+			if got[i] != want[i] {
+				t.Errorf("%q: got %v, want %v", name, got, want)
+				break
+			}
+		}
+	}
+
+	if cfg := c.withAccount(c.accounts[0]); cfg.sessdata != "vip%2Csess" || c.sessdata != "main" {
+		t.Error("withAccount should not modify the shared config")
+	}
+}
+
+func TestWithAccountsFallback(t *testing.T) {
+	accounts := []account{{name: "a"}, {name: "b"}, {name: "c"}}
+
+	// 风控时换用下一个账号
+	tried := 0
+	_, acc, err := withAccounts(accounts, func(acc account) (int, error) {
+		tried++
+		if acc.name == "a" {
+			return 0, &apiError{code: -412, message: "请求被拦截"}
+		}
+		return 1, nil
+	})
+	if err != nil || acc.name != "b" || tried != 2 {
+		t.Errorf("got account %q after %d tries, err: %v", acc.name, tried, err)
+	}
+
+	// 其他错误直接返回
+	tried = 0
+	_, _, err = withAccounts(accounts, func(acc account) (int, error) {
+		tried++
+		return 0, errors.New("视频不存在")
+	})
+	if err == nil || tried != 1 {
+		t.Errorf("got %d tries, err: %v", tried, err)
+	}
+
+	// 未购买的课程不换用账号
+	tried = 0
+	_, _, err = withAccounts(accounts, func(acc account) (int, error) {
+		tried++
+		return 0, errCoursePurchase("课程")
+	})
+	if status.Code(err) != codes.PermissionDenied || tried != 1 {
+		t.Errorf("got %d tries, err: %v", tried, err)
+	}
+
+	// 全部失败时返回第一个账号的错误
+	_, _, err = withAccounts(accounts, func(acc account) (int, error) {
+		return 0, &apiError{code: -101, message: acc.name}
+	})
+	var apiErr *apiError
+	if !errors.As(err, &apiErr) || apiErr.message != "a" {
+		t.Errorf("got err: %v, want error of the first account", err)
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/go-resty/resty/v2"
+)
+
+const userAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/129.0.0.0 Safari/537.36"
+
+// 测试时替换为本地服务
+var apiBase = "https://api.bilibili.com"
+
+// 接口通用响应
+type apiResponse[T any] struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Msg     string `json:"msg"` // 音频区接口使用 msg
+	Data    T      `json:"data"`
+	Result  T      `json:"result"` // pgc 接口使用 result
+}
+
+// 接口返回的错误码
+type apiError struct {
+	code    int
+	message string
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("%s (%d)", e.message, e.code)
+}
+
+// 视频详情
+type viewData struct {
+	Aid      int    `json:"aid"`
+	Bvid     string `json:"bvid"`
+	Title    string `json:"title"`
+	Pic      string `json:"pic"`
+	Desc     string `json:"desc"`
+	Pubdate  int64  `json:"pubdate"`
+	Duration int64  `json:"duration"`
+	Owner    struct {
+		Mid  int64  `json:"mid"`
+		Name string `json:"name"`
+	} `json:"owner"`
+	Rights struct {
+		IsSteinGate int `json:"is_stein_gate"` // 互动视频
+	} `json:"rights"`
+	Pages           []viewPage `json:"pages"`
+	IsSeasonDisplay bool       `json:"is_season_display"`
+	UgcSeason       *ugcSeason `json:"ugc_season"`
+}
+
+type viewPage struct {
+	Cid        int    `json:"cid"`
+	Page       int    `json:"page"`
+	Part       string `json:"part"`
+	Duration   int64  `json:"duration"`
+	FirstFrame string `json:"first_frame"`
+}
+
+// 所有请求都通过这里设置 cookie, 库的客户端只有一个全局 SESSDATA, 无法按任务切换账号
+func newRequest(sessdata string) *resty.Request {
+	return resty.New().R().
+		SetHeader("Referer", "https://www.bilibili.com/").
+		SetHeader("User-Agent", userAgent).
+		SetCookie(&http.Cookie{
+			Name:  "SESSDATA",
+			Value: sessdata,
+		})
+}
+
+// 请求接口并解析 data 字段
+func apiGet[T any](sessdata, url string, params map[string]string) (*T, error) {
+	result, err := apiRequest[T](sessdata, url, params)
+	if err != nil {
+		return nil, err
+	}
+	return &result.Data, nil
+}
+
+// 请求 pgc 接口并解析 result 字段
+func pgcGet[T any](sessdata, url string, params map[string]string) (*T, error) {
+	result, err := apiRequest[T](sessdata, url, params)
+	if err != nil {
+		return nil, err
+	}
+	return &result.Result, nil
+}
+
+func apiRequest[T any](sessdata, url string, params map[string]string) (*apiResponse[T], error) {
+	resp, err := newRequest(sessdata).
+		SetQueryParams(params).
+		Get(url)
+	if err != nil {
+		return nil, err
+	}
+	return decodeAPI[T](resp)
+}
+
+// 检查响应状态并解析错误码, 所有接口的错误都在这里转换为 apiError
+// okCodes 为调用方视为正常的错误码, e.g. 导航接口未登录时的 -101
+func decodeAPI[T any](resp *resty.Response, okCodes ...int) (*apiResponse[T], error) {
+	// 请求过于频繁时被风控拦截
+	if resp.StatusCode() == http.StatusPreconditionFailed {
+		return nil, &apiError{code: -412, message: "请求被拦截"}
+	}
+	if resp.StatusCode() != http.StatusOK {
+		return nil, fmt.Errorf("请求失败: %s", resp.Status())
+	}
+
+	var result apiResponse[T]
+	if err := json.Unmarshal(resp.Body(), &result); err != nil {
+		return nil, err
+	}
+
+	if result.Code != 0 && !slices.Contains(okCodes, result.Code) {
+		message := result.Message
+		if message == "" {
+			message = result.Msg
+		}
+		return nil, &apiError{code: result.Code, message: message}
+	}
+	return &result, nil
+}
+
+// 获取视频详情
+func fetchView(sessdata string, aid int, bvid string) (*viewData, error) {
+	params := map[string]string{}
+	if bvid != "" {
+		params["bvid"] = bvid
+	} else {
+		params["aid"] = fmt.Sprint(aid)
+	}
+	return apiGet[viewData](sessdata, apiBase+"/x/web-interface/view", params)
+}
+
+// 获取链接对应分P的 cid, 默认第一P
+func fetchCid(sessdata, link string) (int, error) {
+	target := classifyURL(link)
+	view, err := fetchView(sessdata, target.aid, target.bvid)
+	if err != nil {
+		return 0, err
+	}
+
+	page := 1
+	if target.kind == linkPage {
+		page = target.page
+	}
+
+	for _, p := range view.Pages {
+		if p.Page == page {
+			return p.Cid, nil
+		}
+	}
+	return 0, fmt.Errorf("未找到第 %d P", page)
+}
+
+// 分P时长, 未找到时返回整个视频时长
+func (v *viewData) pageDuration(cid int) int64 {
+	for _, page := range v.Pages {
+		if page.Cid == cid {
+			return page.Duration
+		}
+	}
+	return v.Duration
+}
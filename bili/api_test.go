@@ -0,0 +1,49 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDecodeAPI(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/412":
+			w.WriteHeader(http.StatusPreconditionFailed)
+		case "/login":
+			w.Write([]byte(`{"code":-101,"message":"账号未登录","data":{"isLogin":false}}`))
+		case "/msg":
+			w.Write([]byte(`{"code":72000000,"msg":"歌曲不存在"}`))
+		default:
+			w.Write([]byte(`{"code":0,"data":{"isLogin":true,"mid":1}}`))
+		}
+	}))
+	defer server.Close()
+
+	get := func(path string, okCodes ...int) (*apiResponse[navData], error) {
+		resp, err := newRequest("").Get(server.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return decodeAPI[navData](resp, okCodes...)
+	}
+
+	var apiErr *apiError
+	if _, err := get("/412"); !errors.As(err, &apiErr) || apiErr.code != -412 {
+		t.Errorf("412: got %v", err)
+	}
+	if _, err := get("/login"); !errors.As(err, &apiErr) || apiErr.code != -101 {
+		t.Errorf("-101: got %v", err)
+	}
+	if nav, err := get("/login", -101); err != nil || nav.Data.IsLogin {
+		t.Errorf("-101 allowed: got %+v, %v", nav, err)
+	}
+	if _, err := get("/msg"); !errors.As(err, &apiErr) || apiErr.message != "歌曲不存在" {
+		t.Errorf("msg: got %v", err)
+	}
+	if nav, err := get("/"); err != nil || nav.Data.Mid != 1 {
+		t.Errorf("ok: got %+v, %v", nav, err)
+	}
+}
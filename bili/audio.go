@@ -0,0 +1,114 @@
+package main
+
+import (
+	"strings"
+
+	pb "proto"
+
+	ffmpeg_go "github.com/u2takey/ffmpeg-go"
+)
+
+// 音频编码, 对应 Format.Code
+const (
+	audioCodecAAC   = "aac"
+	audioCodecFLAC  = "flac"
+	audioCodecDolby = "ec-3"
+)
+
+// 输出格式, 对应 output 片段的 Format.Code
+const outputVideo = "mp4"
+
+// 仅音频时支持的输出格式
+var audioFormats = []string{"m4a", "mp3", "opus", "flac"}
+
+// 任务可选的输出格式, 没有 ffmpeg 时只提供无需转码的 m4a
+func newOutputSegment(config *Config) *pb.Segment {
+	_, hasFFmpeg := ffmpegPath(config)
+	audioFormat := availableAudioFormat(config.audioFormat, hasFFmpeg)
+
+	selected := outputVideo
+	if !config.downloadVideo {
+		selected = audioFormat
+	}
+
+	seg := &pb.Segment{
+		MimeType: "output",
+		Formats: []*pb.Format{
+			{MimeType: "output", Label: "视频 (mp4)", Code: outputVideo},
+			{MimeType: "output", Label: "仅音频 (m4a)", Code: "m4a"},
+		},
+	}
+	if hasFFmpeg {
+		seg.Formats = append(seg.Formats,
+			&pb.Format{MimeType: "output", Label: "仅音频 (mp3)", Code: "mp3"},
+			&pb.Format{MimeType: "output", Label: "仅音频 (opus)", Code: "opus"},
+			&pb.Format{MimeType: "output", Label: "仅音频 (flac)", Code: "flac"},
+		)
+	}
+
+	for _, fm := range seg.Formats {
+		fm.Selected = fm.Code == selected
+	}
+	return seg
+}
+
+// 仅音频的输出格式, 用于音频区歌曲
+func newAudioOutputSegment(config *Config) *pb.Segment {
+	_, hasFFmpeg := ffmpegPath(config)
+	audioFormat := availableAudioFormat(config.audioFormat, hasFFmpeg)
+
+	seg := newOutputSegment(config)
+	seg.Formats = seg.Formats[1:]
+	for _, fm := range seg.Formats {
+		fm.Selected = fm.Code == audioFormat
+	}
+	return seg
+}
+
+// 转码需要 ffmpeg, 没有时使用 m4a
+func availableAudioFormat(format string, hasFFmpeg bool) string {
+	if !hasFFmpeg {
+		return "m4a"
+	}
+	return format
+}
+
+func isAudioFormat(format string) bool {
+	for _, f := range audioFormats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+// 仅音频时的文件后缀, m4a 下 FLAC 音轨保持原样
+// 没有 ffmpeg 时无法转封装, 保留 m4a 直接使用 FLAC-in-MP4
+func audioExtension(format, codec string, hasFFmpeg bool) string {
+	if format == "m4a" && strings.EqualFold(codec, audioCodecFLAC) && hasFFmpeg {
+		return ".flac"
+	}
+	return "." + format
+}
+
+// 提取音频时的 ffmpeg 参数
+func audioCodecArgs(ext, codec string) ffmpeg_go.KwArgs {
+	kwargs := ffmpeg_go.KwArgs{"vn": ""}
+
+	switch ext {
+	case ".mp3":
+		kwargs["c:a"] = "libmp3lame"
+		kwargs["q:a"] = "2"
+	case ".opus":
+		kwargs["c:a"] = "libopus"
+		kwargs["b:a"] = "192k"
+	case ".flac":
+		kwargs["c:a"] = "flac"
+		if strings.EqualFold(codec, audioCodecFLAC) {
+			kwargs["c:a"] = "copy"
+		}
+	default:
+		kwargs["c:a"] = "copy"
+	}
+	return kwargs
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAudioExtension(t *testing.T) {
+	for _, tt := range []struct {
+		format, codec string
+		ffmpeg        bool
+		want          string
+	}{
+		{"m4a", "aac", true, ".m4a"},
+		{"m4a", "flac", true, ".flac"},
+		{"m4a", "flac", false, ".m4a"},
+		{"m4a", "ec-3", true, ".m4a"},
+		{"mp3", "flac", true, ".mp3"},
+		{"opus", "aac", true, ".opus"},
+	} {
+		if got := audioExtension(tt.format, tt.codec, tt.ffmpeg); got != tt.want {
+			t.Errorf("audioExtension(%q, %q, %v) = %q, want %q", tt.format, tt.codec, tt.ffmpeg, got, tt.want)
+		}
+	}
+}
+
+func TestNewJobAudioOnly(t *testing.T) {
+	c := NewConfig()
+	c.ffmpeg = os.Args[0] // 转码需要 ffmpeg, 使用任意存在的文件代替
+	task := newTask("标题", "https://www.bilibili.com/video/BV1xx411c7mD", "1", "")
+	task.WorkDir = "work"
+	task.Segments = append(task.Segments, newOutputSegment(c))
+
+	// 主机按任务选择仅音频
+	for _, fm := range task.Segments[len(task.Segments)-1].Formats {
+		fm.Selected = fm.Code == "mp3"
+	}
+
+	job, err := NewJob(nil, task, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.downloadVideo || !job.downloadAudio {
+		t.Errorf("got video=%v audio=%v, want audio only", job.downloadVideo, job.downloadAudio)
+	}
+	if task.Filepath != filepath.Join("work", "标题.mp3") {
+		t.Errorf("got filepath %q", task.Filepath)
+	}
+	if ext := filepath.Ext(job.audio.filepath); ext != ".m4s" {
+		t.Errorf("got temp audio extension %q", ext)
+	}
+}
+
+func TestAudioOutputWithoutFFmpeg(t *testing.T) {
+	t.Setenv("PATH", "")
+	c := NewConfig()
+	c.downloadVideo = false
+	c.audioFormat = "mp3"
+
+	// 只提供 m4a, 设置的格式需要转码时改为选择 m4a
+	seg := newOutputSegment(c)
+	for _, fm := range seg.Formats {
+		if fm.Code != outputVideo && fm.Code != "m4a" {
+			t.Errorf("unexpected output %s without ffmpeg", fm.Code)
+		}
+		if fm.Selected != (fm.Code == "m4a") {
+			t.Errorf("%s: selected=%v", fm.Code, fm.Selected)
+		}
+	}
+
+	// 主机未选择输出格式时使用设置, 在开始下载前拒绝
+	task := newTask("标题", "https://www.bilibili.com/video/BV1xx411c7mD", "1", "")
+	if _, err := NewJob(nil, task, c); err == nil || !strings.Contains(err.Error(), "ffmpeg") {
+		t.Errorf("got %v, want error for mp3 output without ffmpeg", err)
+	}
+}
+
+func TestPlayURLAudioStreams(t *testing.T) {
+	data := `{
+		"timelength": 200000,
+		"dash": {
+			"audio": [{"id": 30280, "base_url": "https://example.com/aac.m4s", "codecs": "mp4a.40.2"}],
+			"dolby": {"type": 1, "audio": [{"id": 30250, "base_url": "https://example.com/dolby.m4s", "codecs": "ec-3"}]},
+			"flac": {"display": true, "audio": {"id": 30251, "base_url": "https://example.com/flac.m4s", "codecs": "fLaC"}}
+		}
+	}`
+
+	var p playURLData
+	if err := json.Unmarshal([]byte(data), &p); err != nil {
+		t.Fatal(err)
+	}
+
+	streams := p.audioStreams()
+	want := []struct{ label, code string }{
+		{"Hi-Res无损 | FLAC", audioCodecFLAC},
+		{"杜比全景声 | EC-3", audioCodecDolby},
+		{"192K | AAC", audioCodecAAC},
+	}
+	if len(streams) != len(want) {
+		t.Fatalf("got %d streams, want %d", len(streams), len(want))
+	}
+	for i, w := range want {
+		if streams[i].label != w.label || streams[i].code != w.code {
+			t.Errorf("stream %d: got %q %q, want %q %q", i, streams[i].label, streams[i].code, w.label, w.code)
+		}
+	}
+}
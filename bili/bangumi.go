@@ -0,0 +1,158 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	pb "proto"
+)
+
+// 番剧信息
+type seasonData struct {
+	SeasonID int    `json:"season_id"`
+	Title    string `json:"title"`
+	Cover    string `json:"cover"`
+	UpInfo   struct {
+		Uname string `json:"uname"`
+	} `json:"up_info"`
+	UserStatus struct {
+		AreaLimit int `json:"area_limit"` // 1:当前地区不可观看
+	} `json:"user_status"`
+	Episodes []seasonEpisode `json:"episodes"`
+	Section  []struct {
+		Title    string          `json:"title"`
+		Episodes []seasonEpisode `json:"episodes"`
+	} `json:"section"`
+}
+
+type seasonEpisode struct {
+	ID        int    `json:"id"`
+	Aid       int    `json:"aid"`
+	Bvid      string `json:"bvid"`
+	Cid       int    `json:"cid"`
+	Title     string `json:"title"`
+	LongTitle string `json:"long_title"`
+	ShowTitle string `json:"show_title"`
+	Cover     string `json:"cover"`
+	Badge     string `json:"badge"`
+}
+
+func bangumiURL(epid int) string {
+	return "https://www.bilibili.com/bangumi/play/ep" + strconv.Itoa(epid)
+}
+
+// 获取番剧信息, 支持 ep/ss/md
+func fetchSeason(sessdata, kind string, id int) (*seasonData, error) {
+	params := map[string]string{}
+
+	switch kind {
+	case "ep":
+		params["ep_id"] = strconv.Itoa(id)
+	case "ss":
+		params["season_id"] = strconv.Itoa(id)
+	case "md":
+		review, err := pgcGet[struct {
+			Media struct {
+				SeasonID int `json:"season_id"`
+			} `json:"media"`
+		}](sessdata, apiBase+"/pgc/review/user", map[string]string{"media_id": strconv.Itoa(id)})
+		if err != nil {
+			return nil, pgcError(err, false)
+		}
+		params["season_id"] = strconv.Itoa(review.Media.SeasonID)
+	default:
+		return nil, fmt.Errorf("不支持的番剧链接: %s%d", kind, id)
+	}
+
+	season, err := pgcGet[seasonData](sessdata, apiBase+"/pgc/view/web/season", params)
+	if err != nil {
+		return nil, pgcError(err, false)
+	}
+	return season, nil
+}
+
+// 当前地区是否受限
+func (season *seasonData) areaLimited() bool {
+	return season.UserStatus.AreaLimit == 1
+}
+
+// 番剧任务列表, 包括正片与 PV/花絮等其他分区
+func (season *seasonData) tasks() []*pb.Task {
+	tasks := make([]*pb.Task, 0)
+
+	for _, ep := range season.Episodes {
+		tasks = append(tasks, newTask(ep.displayTitle(""), bangumiURL(ep.ID), strconv.Itoa(ep.Cid), ep.Cover))
+	}
+
+	for _, section := range season.Section {
+		for _, ep := range section.Episodes {
+			tasks = append(tasks, newTask(ep.displayTitle(section.Title), bangumiURL(ep.ID), strconv.Itoa(ep.Cid), ep.Cover))
+		}
+	}
+	return tasks
+}
+
+func (ep seasonEpisode) displayTitle(section string) string {
+	title := ep.ShowTitle
+	if title == "" {
+		title = strings.TrimSpace(ep.Title + " " + ep.LongTitle)
+	}
+
+	if section != "" {
+		title = section + " " + title
+	}
+	return title
+}
+
+// 获取番剧视频流
+func fetchPGCPlayURL(sessdata string, epid, cid int, fnval int) (*playURLData, error) {
+	params := map[string]string{
+		"ep_id": strconv.Itoa(epid),
+		"cid":   strconv.Itoa(cid),
+		"fnval": strconv.Itoa(fnval),
+		"fnver": "0",
+		"qn":    "127",
+	}
+	if fnval&fnval4K != 0 {
+		params["fourk"] = "1"
+	}
+
+	data, err := pgcGet[playURLData](sessdata, apiBase+"/pgc/player/web/playurl", params)
+	if err != nil {
+		// 地区限制与大会员限制使用相同的错误码, 通过番剧信息中的地区限制区分
+		var apiErr *apiError
+		areaLimited := false
+		if errors.As(err, &apiErr) && apiErr.code == pgcCodeRestricted {
+			season, seasonErr := fetchSeason(sessdata, "ep", epid)
+			areaLimited = seasonErr == nil && season.areaLimited()
+		}
+		return nil, pgcError(err, areaLimited)
+	}
+	return data, nil
+}
+
+// 番剧接口错误码
+const (
+	pgcCodeRestricted = -10403  // 地区或大会员限制
+	pgcCodeAreaLimit  = 6002003 // 地区限制
+)
+
+// 转换番剧接口的错误码, areaLimited 为番剧信息中的地区限制
+func pgcError(err error, areaLimited bool) error {
+	var apiErr *apiError
+	if !errors.As(err, &apiErr) {
+		return err
+	}
+
+	switch {
+	case apiErr.code == pgcCodeAreaLimit, apiErr.code == pgcCodeRestricted && areaLimited:
+		return fmt.Errorf("该剧集在当前地区不可观看: %w", err)
+	case apiErr.code == pgcCodeRestricted:
+		return fmt.Errorf("该剧集需要大会员: %w", err)
+	case apiErr.code == -404:
+		return fmt.Errorf("剧集不存在: %w", err)
+	}
+	return err
+}
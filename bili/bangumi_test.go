@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestClassifyBangumi(t *testing.T) {
+	for link, want := range map[string]struct {
+		kind string
+		id   int
+	}{
+		"https://www.bilibili.com/bangumi/play/ep123456?from=search": {"ep", 123456},
+		"https://www.bilibili.com/bangumi/play/ss789":                {"ss", 789},
+		"https://www.bilibili.com/bangumi/media/md28229233/":         {"md", 28229233},
+		"https://www.bilibili.com/video/BV1xx411c7mD":                {"", 0},
+	} {
+		target := classifyURL(link)
+		if target.kind != linkBangumi {
+			target = linkTarget{}
+		}
+		if target.sub != want.kind || target.id != want.id {
+			t.Errorf("%s: got %s %d, want %s %d", link, target.sub, target.id, want.kind, want.id)
+		}
+	}
+}
+
+func TestSeasonTasks(t *testing.T) {
+	data := `{
+		"title": "番剧",
+		"episodes": [{"id": 1, "cid": 11, "title": "1", "long_title": "开始", "show_title": "第1话 开始"}],
+		"section": [{"title": "PV", "episodes": [{"id": 2, "cid": 22, "title": "PV1"}]}]
+	}`
+
+	var season seasonData
+	if err := json.Unmarshal([]byte(data), &season); err != nil {
+		t.Fatal(err)
+	}
+
+	tasks := season.tasks()
+	if len(tasks) != 2 {
+		t.Fatalf("got %d tasks, want 2", len(tasks))
+	}
+	if tasks[0].Title != "第1话 开始" || tasks[0].SessionId != "11" || !strings.HasSuffix(tasks[0].Url, "/ep1") {
+		t.Errorf("unexpected task: %v", tasks[0])
+	}
+	if tasks[1].Title != "PV PV1" || tasks[1].SessionId != "22" {
+		t.Errorf("unexpected task: %v", tasks[1])
+	}
+}
+
+func TestPGCError(t *testing.T) {
+	// 不依赖提示文字, 按错误码与地区限制判断
+	err := pgcError(&apiError{code: -10403, message: "限制"}, true)
+	if !strings.Contains(err.Error(), "地区不可观看") {
+		t.Errorf("got %v", err)
+	}
+
+	err = pgcError(&apiError{code: 6002003, message: ""}, false)
+	if !strings.Contains(err.Error(), "地区不可观看") {
+		t.Errorf("got %v", err)
+	}
+
+	err = pgcError(&apiError{code: -10403, message: "抱歉您所在地区不可观看！"}, false)
+	if !strings.Contains(err.Error(), "需要大会员") {
+		t.Errorf("got %v", err)
+	}
+}
+
+func TestSeasonAreaLimited(t *testing.T) {
+	var season seasonData
+	if err := json.Unmarshal([]byte(`{"user_status": {"area_limit": 1}}`), &season); err != nil {
+		t.Fatal(err)
+	}
+	if !season.areaLimited() {
+		t.Error("season should be area limited")
+	}
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	stallTimeout = 15 * time.Second // 超过该时间没有数据视为节点停滞
+	raceBytes    = 1024 * 1024      // 测速下载的字节数
+	raceTimeout  = 20 * time.Second // 测速最长时间
+)
+
+var errStreamStalled = errors.New("下载节点长时间没有响应")
+
+// CDN 策略
+const (
+	cdnOriginal  = "original"   // 保持原始链接
+	cdnUpos      = "upos"       // 优先改写为指定的 upos 节点
+	cdnAvoidMcdn = "avoid_mcdn" // 避开 mcdn/PCDN 节点
+)
+
+var defaultUposHosts = []string{
+	"upos-sz-mirrorali.bilivideo.com",
+	"upos-sz-mirrorcos.bilivideo.com",
+	"upos-sz-mirrorhw.bilivideo.com",
+}
+
+type cdnPolicy struct {
+	mode  string
+	hosts []string // upos 节点优先级
+}
+
+func newCDNPolicy() cdnPolicy {
+	return cdnPolicy{mode: cdnOriginal, hosts: defaultUposHosts}
+}
+
+// 按策略排列候选链接, 原始链接保留在后面作为失败时的回退
+func (p cdnPolicy) apply(links []string) []string {
+	out := make([]string, 0, len(links))
+	add := func(link string) {
+		if !slices.Contains(out, link) {
+			out = append(out, link)
+		}
+	}
+
+	switch p.mode {
+	case cdnUpos:
+		for _, host := range p.hosts {
+			for _, link := range links {
+				if rewritten, ok := rewriteHost(link, host); ok {
+					add(rewritten)
+				}
+			}
+		}
+	case cdnAvoidMcdn:
+		for _, link := range links {
+			if !isMcdn(link) {
+				add(link)
+			}
+		}
+	}
+
+	for _, link := range links {
+		add(link)
+	}
+	return out
+}
+
+// mcdn 与 PCDN 节点, 部分网络下速度很慢
+func isMcdn(link string) bool {
+	u, err := url.Parse(link)
+	if err != nil {
+		return false
+	}
+	host := u.Hostname()
+	source := u.Query().Get("os")
+	return strings.HasSuffix(host, ".mcdn.bilivideo.cn") ||
+		strings.HasSuffix(host, ".szbdyd.com") ||
+		u.Port() == "8082" ||
+		source == "mcdn" || source == "pcdn"
+}
+
+// 将 upos 路径的链接改写到指定节点, mcdn 的资源路径不能改写
+func rewriteHost(link, host string) (string, bool) {
+	u, err := url.Parse(link)
+	if err != nil || !strings.HasPrefix(u.Path, "/upgcxcode/") || isMcdn(link) {
+		return "", false
+	}
+	u.Scheme, u.Host = "https", host
+	return u.String(), true
+}
+
+// 主链接与备用链接
+func (d *dashStream) urls() []string {
+	return append([]string{d.BaseURL}, d.BackupURL...)
+}
+
+func (m *Media) backupCount() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.backups)
+}
+
+// 丢弃失败的链接并切换到下一个备用链接, 没有可用链接时返回 false
+func (m *Media) failover(failed string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// 其他分块已经切换过
+	if m.url != failed {
+		return true
+	}
+	if len(m.backups) == 0 {
+		return false
+	}
+
+	log.Printf("切换下载节点: %s", m.backups[0])
+	m.url, m.backups = m.backups[0], m.backups[1:]
+	return true
+}
+
+// 设置候选链接, 第一个为主链接
+func (m *Media) setURLs(links []string) {
+	m.url, m.backups = links[0], links[1:]
+}
+
+// 测速选择最快的节点作为主链接
+func (j *Job) raceCDN(m *Media) {
+	m.mu.Lock()
+	links := append([]string{m.url}, m.backups...)
+	sessdata := m.sessdata
+	m.mu.Unlock()
+
+	if len(links) < 2 {
+		return
+	}
+
+	fastest, err := raceURLs(sessdata, links)
+	if err != nil {
+		fmt.Printf("节点测速失败, err: %s\n", err.Error())
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.url, m.backups = fastest, make([]string, 0, len(links)-1)
+	for _, link := range links {
+		if link != fastest {
+			m.backups = append(m.backups, link)
+		}
+	}
+}
+
+// 同时下载各节点的前 raceBytes 字节, 返回最先完成的链接
+func raceURLs(sessdata string, links []string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), raceTimeout)
+	defer cancel()
+
+	type result struct {
+		link string
+		err  error
+	}
+	results := make(chan result, len(links))
+
+	for _, link := range links {
+		go func(link string) {
+			results <- result{link, probeURL(ctx, sessdata, link)}
+		}(link)
+	}
+
+	var err error
+	for range links {
+		r := <-results
+		if r.err == nil {
+			return r.link, nil
+		}
+		err = r.err
+	}
+	return "", err
+}
+
+// 下载链接的前 raceBytes 字节
+func probeURL(ctx context.Context, sessdata, link string) error {
+	resp, err := newRequest(sessdata).
+		SetContext(ctx).
+		SetHeader("Range", fmt.Sprintf("bytes=0-%d", raceBytes-1)).
+		SetDoNotParseResponse(true).
+		Get(link)
+	if err != nil {
+		return err
+	}
+	defer resp.RawBody().Close()
+
+	if resp.StatusCode() != http.StatusPartialContent && resp.StatusCode() != http.StatusOK {
+		return fmt.Errorf("请求失败: %s", resp.Status())
+	}
+	_, err = io.CopyN(io.Discard, resp.RawBody(), raceBytes)
+	if errors.Is(err, io.EOF) {
+		return nil // 文件小于测速大小
+	}
+	return err
+}
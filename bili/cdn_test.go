@@ -0,0 +1,94 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMediaFailover(t *testing.T) {
+	m := &Media{url: "a", backups: []string{"b", "c"}}
+
+	if !m.failover("a") || m.url != "b" {
+		t.Fatalf("got %q", m.url)
+	}
+	// 其他分块已经切换过, 不再重复切换
+	if !m.failover("a") || m.url != "b" {
+		t.Fatalf("got %q", m.url)
+	}
+	if !m.failover("b") || m.url != "c" {
+		t.Fatalf("got %q", m.url)
+	}
+	if m.failover("c") {
+		t.Error("failover should stop when no backups left")
+	}
+}
+
+func TestRaceCDN(t *testing.T) {
+	handler := func(delay time.Duration) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(delay)
+			w.WriteHeader(http.StatusPartialContent)
+			w.Write(make([]byte, 1024))
+		}
+	}
+	slow := httptest.NewServer(handler(500 * time.Millisecond))
+	defer slow.Close()
+	fast := httptest.NewServer(handler(0))
+	defer fast.Close()
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer broken.Close()
+
+	j := &Job{config: NewConfig()}
+	m := &Media{url: slow.URL, backups: []string{broken.URL, fast.URL}}
+	j.raceCDN(m)
+
+	if m.url != fast.URL {
+		t.Errorf("got %q, want fastest %q", m.url, fast.URL)
+	}
+	if len(m.backups) != 2 || m.backups[0] != slow.URL || m.backups[1] != broken.URL {
+		t.Errorf("unexpected backups: %v", m.backups)
+	}
+}
+
+func TestCDNPolicy(t *testing.T) {
+	upos := "https://cn-sccd-ct-01-18.bilivideo.com/upgcxcode/99/88/196018899/196018899-1-30120.m4s?deadline=1728637696&os=bcache"
+	mcdn := "https://xy119x188x114x50xy.mcdn.bilivideo.cn:8082/v1/resource/196018899_nb3-1-30280.m4s?deadline=1728637696&os=mcdn"
+
+	cases := []struct {
+		policy cdnPolicy
+		links  []string
+		want   []string
+	}{
+		{newCDNPolicy(), []string{mcdn, upos}, []string{mcdn, upos}},
+		{cdnPolicy{mode: cdnAvoidMcdn}, []string{mcdn, upos}, []string{upos, mcdn}},
+		{
+			cdnPolicy{mode: cdnUpos, hosts: []string{"upos-sz-mirrorali.bilivideo.com"}},
+			[]string{mcdn, upos},
+			[]string{
+				"https://upos-sz-mirrorali.bilivideo.com/upgcxcode/99/88/196018899/196018899-1-30120.m4s?deadline=1728637696&os=bcache",
+				mcdn,
+				upos,
+			},
+		},
+		// 没有可改写的链接时保持原样
+		{cdnPolicy{mode: cdnUpos, hosts: defaultUposHosts}, []string{mcdn}, []string{mcdn}},
+	}
+
+	for _, c := range cases {
+		got := c.policy.apply(c.links)
+		if len(got) != len(c.want) {
+			t.Errorf("%s: got %v, want %v", c.policy.mode, got, c.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != c.want[i] {
+				t.Errorf("%s: got %v, want %v", c.policy.mode, got, c.want)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	pb "proto"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// 课程信息
+type courseData struct {
+	SeasonID int    `json:"season_id"`
+	Title    string `json:"title"`
+	Cover    string `json:"cover"`
+	UpInfo   struct {
+		Uname string `json:"uname"`
+	} `json:"up_info"`
+	UserStatus struct {
+		Payed int `json:"payed"` // 1:已购买
+	} `json:"user_status"`
+	Episodes []courseEpisode `json:"episodes"`
+}
+
+type courseEpisode struct {
+	ID     int    `json:"id"`
+	Aid    int    `json:"aid"`
+	Cid    int    `json:"cid"`
+	Title  string `json:"title"`
+	Index  int    `json:"index"`
+	Cover  string `json:"cover"`
+	Status int    `json:"status"` // 1:可观看 2:需要购买
+}
+
+func cheeseURL(epid int) string {
+	return "https://www.bilibili.com/cheese/play/ep" + strconv.Itoa(epid)
+}
+
+// 获取课程信息, 支持 ep/ss
+func fetchCourse(sessdata, kind string, id int) (*courseData, error) {
+	params := map[string]string{}
+	switch kind {
+	case "ep":
+		params["ep_id"] = strconv.Itoa(id)
+	case "ss":
+		params["season_id"] = strconv.Itoa(id)
+	default:
+		return nil, fmt.Errorf("不支持的课程链接: %s%d", kind, id)
+	}
+
+	course, err := apiGet[courseData](sessdata, apiBase+"/pugv/view/web/season", params)
+	if err != nil {
+		return nil, fmt.Errorf("获取课程信息失败, err: %w", err)
+	}
+	return course, nil
+}
+
+// 是否可以观看, 试看或已购买
+func (c *courseData) playable(ep *courseEpisode) bool {
+	return ep.Status == 1 || c.UserStatus.Payed == 1
+}
+
+func (c *courseData) episode(epid int) *courseEpisode {
+	for i := range c.Episodes {
+		if c.Episodes[i].ID == epid {
+			return &c.Episodes[i]
+		}
+	}
+	return nil
+}
+
+// 课程任务列表, 未购买的章节在标题中标注
+func (c *courseData) tasks() []*pb.Task {
+	tasks := make([]*pb.Task, 0, len(c.Episodes))
+	for i := range c.Episodes {
+		ep := &c.Episodes[i]
+
+		title := fmt.Sprintf("%d. %s", ep.Index, ep.Title)
+		if !c.playable(ep) {
+			title += " (未购买)"
+		}
+
+		task := newTask(title, cheeseURL(ep.ID), strconv.Itoa(ep.Cid), ep.Cover)
+		task.Series = c.Title
+		tasks = append(tasks, task)
+	}
+	return tasks
+}
+
+// 获取课程视频流, 未购买时返回 PermissionDenied
+func fetchCheesePlayURL(sessdata string, epid, cid int, fnval int) (*playURLData, error) {
+	course, err := fetchCourse(sessdata, "ep", epid)
+	if err != nil {
+		return nil, err
+	}
+
+	ep := course.episode(epid)
+	if ep == nil {
+		return nil, fmt.Errorf("课程中没有该章节: ep%d", epid)
+	}
+	if !course.playable(ep) {
+		return nil, errCoursePurchase(course.Title)
+	}
+
+	params := map[string]string{
+		"avid":  strconv.Itoa(ep.Aid),
+		"cid":   strconv.Itoa(cid),
+		"ep_id": strconv.Itoa(epid),
+		"fnval": strconv.Itoa(fnval),
+		"fnver": "0",
+		"qn":    "127",
+	}
+	if fnval&fnval4K != 0 {
+		params["fourk"] = "1"
+	}
+
+	data, err := apiGet[playURLData](sessdata, apiBase+"/pugv/player/web/playurl", params)
+	if err != nil {
+		var apiErr *apiError
+		if errors.As(err, &apiErr) && (apiErr.code == -403 || apiErr.code == -10403) {
+			return nil, errCoursePurchase(course.Title)
+		}
+		return nil, fmt.Errorf("获取数据失败, err: %s", err.Error())
+	}
+	return data, nil
+}
+
+func errCoursePurchase(title string) error {
+	return status.Errorf(codes.PermissionDenied, "课程未购买: %s", title)
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestCourseTasks(t *testing.T) {
+	data := `{
+		"season_id": 1,
+		"title": "课程",
+		"user_status": {"payed": 0},
+		"episodes": [
+			{"id": 11, "aid": 100, "cid": 1000, "title": "试看", "index": 1, "status": 1},
+			{"id": 12, "aid": 101, "cid": 1001, "title": "正课", "index": 2, "status": 2}
+		]
+	}`
+
+	var course courseData
+	if err := json.Unmarshal([]byte(data), &course); err != nil {
+		t.Fatal(err)
+	}
+
+	tasks := course.tasks()
+	if len(tasks) != 2 {
+		t.Fatalf("got %d tasks, want 2", len(tasks))
+	}
+	if tasks[0].Title != "1. 试看" || tasks[0].Url != "https://www.bilibili.com/cheese/play/ep11" || tasks[0].SessionId != "1000" {
+		t.Errorf("unexpected task: %v", tasks[0])
+	}
+	if tasks[1].Title != "2. 正课 (未购买)" || tasks[1].Series != "课程" {
+		t.Errorf("unexpected task: %v", tasks[1])
+	}
+
+	course.UserStatus.Payed = 1
+	if !course.playable(course.episode(12)) {
+		t.Error("purchased episode should be playable")
+	}
+}
+
+func TestCoursePurchaseError(t *testing.T) {
+	if code := status.Code(errCoursePurchase("课程")); code != codes.PermissionDenied {
+		t.Errorf("got code %s, want PermissionDenied", code)
+	}
+}
@@ -1,15 +1,64 @@
 package main
 
+import (
+	"time"
+
+	"google.golang.org/grpc/metadata"
+)
+
 type Config struct {
 	sessdata         string
 	ffmpeg           string
 	tmpDir           string
+	fnval            int             // 请求的视频流格式
+	selection        selectionPolicy // 自动选择格式
+	seasonScope      string          // 合集下载范围 season/video
+	spaceFilter      spaceFilter     // UP 主投稿筛选
+	liveSegment      time.Duration   // 直播录制分段时长
+	biliJct          string          // csrf, 修改账号数据时需要
+	accounts         []account       // 账号池, 任务可指定账号
+	watchLaterRemove bool            // 下载后从稍后再看中移除
+	historyLimit     int             // 历史记录最多条数
+	cdnRace          bool            // 下载前测速选择最快节点
+	cdn              cdnPolicy       // CDN 节点策略
 	downloadVideo    bool
 	downloadAudio    bool
+	audioFormat      string // 仅音频时的输出格式 m4a/mp3/opus/flac
 	downloadSubtitle bool
+	subtitleFormat   string // 字幕格式 srt/ass
+	muxSubtitle      bool   // 是否将字幕封装进视频
+	downloadDanmaku  bool
+	danmakuFontSize  int      // 弹幕字号(1080P)
+	danmakuOpacity   float64  // 弹幕不透明度 0-1
+	danmakuDuration  float64  // 滚动弹幕停留时间(秒)
+	danmakuDensity   int      // 同屏最大弹幕数, 0 为不限制
+	danmakuKeywords  []string // 弹幕屏蔽词
 	x                [][]int
 }
 
 func NewConfig() *Config {
-	return &Config{}
+	return &Config{
+		fnval:           parseFnval([]string{"hdr", "4k", "dolby_audio", "dolby_vision", "8k", "av1"}),
+		selection:       newSelectionPolicy(),
+		seasonScope:     seasonScopeSeason,
+		liveSegment:     time.Hour,
+		historyLimit:    100,
+		cdn:             newCDNPolicy(),
+		downloadVideo:   true,
+		downloadAudio:   true,
+		audioFormat:     "m4a",
+		subtitleFormat:  "srt",
+		danmakuFontSize: 48,
+		danmakuOpacity:  0.8,
+		danmakuDuration: 8,
+	}
+}
+
+// 读取主机传入的单个参数
+func mdValue(md metadata.MD, key string) (string, bool) {
+	values := md.Get(key)
+	if len(values) > 0 {
+		return values[0], true
+	}
+	return "", false
 }
@@ -0,0 +1,459 @@
+package main
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const danmakuSegmentDuration = 360 // 分段弹幕每段 6 分钟
+
+// 弹幕
+type danmaku struct {
+	time    float64 // 出现时间(秒)
+	mode    int     // 1-3:滚动 4:底部 5:顶部 6:逆向 7:高级 8:代码
+	size    int     // 字号 18:小 25:标准 36:大
+	color   uint32  // RGB
+	content string
+}
+
+// 弹幕转换选项
+type danmakuOptions struct {
+	fontSize       int      // 标准字号
+	opacity        float64  // 不透明度 0-1
+	scrollDuration float64  // 滚动弹幕停留时间(秒)
+	staticDuration float64  // 顶部/底部弹幕停留时间(秒)
+	maxOnScreen    int      // 同屏最大弹幕数, 0 为不限制
+	keywords       []string // 屏蔽关键词
+	width          int
+	height         int
+}
+
+func newDanmakuOptions(config *Config) danmakuOptions {
+	return danmakuOptions{
+		fontSize:       config.danmakuFontSize,
+		opacity:        config.danmakuOpacity,
+		scrollDuration: config.danmakuDuration,
+		staticDuration: 4,
+		maxOnScreen:    config.danmakuDensity,
+		keywords:       config.danmakuKeywords,
+		width:          1920,
+		height:         1080,
+	}
+}
+
+// 下载分段弹幕 (protobuf)
+func fetchDanmakuSegments(sessdata string, cid int, duration int64) ([]danmaku, error) {
+	if duration <= 0 {
+		return nil, errors.New("未知视频时长")
+	}
+
+	list := make([]danmaku, 0)
+	segments := (duration + danmakuSegmentDuration - 1) / danmakuSegmentDuration
+	for i := int64(1); i <= segments; i++ {
+		resp, err := newRequest(sessdata).
+			SetQueryParams(map[string]string{
+				"type":          "1",
+				"oid":           strconv.Itoa(cid),
+				"segment_index": strconv.FormatInt(i, 10),
+			}).
+			Get(apiBase + "/x/v2/dm/web/seg.so")
+		if err != nil {
+			return nil, err
+		}
+
+		if resp.StatusCode() != 200 {
+			return nil, fmt.Errorf("获取弹幕失败: %s", resp.Status())
+		}
+
+		elems, err := parseDanmakuSegment(resp.Body())
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, elems...)
+	}
+	return list, nil
+}
+
+// 解析 DmSegMobileReply, 只读取需要的字段
+func parseDanmakuSegment(data []byte) ([]danmaku, error) {
+	list := make([]danmaku, 0)
+
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		data = data[n:]
+
+		// 1: repeated DanmakuElem elems
+		if num == 1 && typ == protowire.BytesType {
+			elem, n := protowire.ConsumeBytes(data)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			dm, err := parseDanmakuElem(elem)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, dm)
+			data = data[n:]
+			continue
+		}
+
+		n = protowire.ConsumeFieldValue(num, typ, data)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		data = data[n:]
+	}
+	return list, nil
+}
+
+func parseDanmakuElem(data []byte) (danmaku, error) {
+	dm := danmaku{mode: 1, size: 25, color: 0xFFFFFF}
+
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return dm, protowire.ParseError(n)
+		}
+		data = data[n:]
+
+		switch {
+		case typ == protowire.VarintType:
+			v, n := protowire.ConsumeVarint(data)
+			if n < 0 {
+				return dm, protowire.ParseError(n)
+			}
+			switch num {
+			case 2: // progress(毫秒)
+				dm.time = float64(v) / 1000
+			case 3:
+				dm.mode = int(v)
+			case 4:
+				dm.size = int(v)
+			case 5:
+				dm.color = uint32(v)
+			}
+			data = data[n:]
+		case typ == protowire.BytesType && num == 7:
+			v, n := protowire.ConsumeString(data)
+			if n < 0 {
+				return dm, protowire.ParseError(n)
+			}
+			dm.content = v
+			data = data[n:]
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, data)
+			if n < 0 {
+				return dm, protowire.ParseError(n)
+			}
+			data = data[n:]
+		}
+	}
+	return dm, nil
+}
+
+// 下载 xml 弹幕
+func fetchDanmakuXML(sessdata string, cid int) ([]byte, error) {
+	resp, err := newRequest(sessdata).
+		SetQueryParam("oid", strconv.Itoa(cid)).
+		Get(apiBase + "/x/v1/dm/list.so")
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode() != 200 {
+		return nil, fmt.Errorf("获取弹幕失败: %s", resp.Status())
+	}
+
+	body := resp.Body()
+	if bytes.HasPrefix(bytes.TrimSpace(body), []byte("<")) {
+		return body, nil
+	}
+
+	// 接口返回 deflate 压缩数据
+	return io.ReadAll(flate.NewReader(bytes.NewReader(body)))
+}
+
+// 解析 xml 弹幕, p 属性: 时间,类型,字号,颜色,...
+func parseDanmakuXML(data []byte) ([]danmaku, error) {
+	var doc struct {
+		Items []struct {
+			P       string `xml:"p,attr"`
+			Content string `xml:",chardata"`
+		} `xml:"d"`
+	}
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+
+	list := make([]danmaku, 0, len(doc.Items))
+	for _, item := range doc.Items {
+		fields := strings.Split(item.P, ",")
+		if len(fields) < 4 {
+			continue
+		}
+
+		t, _ := strconv.ParseFloat(fields[0], 64)
+		mode, _ := strconv.Atoi(fields[1])
+		size, _ := strconv.Atoi(fields[2])
+		color, _ := strconv.ParseUint(fields[3], 10, 32)
+		list = append(list, danmaku{
+			time:    t,
+			mode:    mode,
+			size:    size,
+			color:   uint32(color),
+			content: item.Content,
+		})
+	}
+	return list, nil
+}
+
+// 下载弹幕并保存为 ass/xml
+func downloadDanmaku(j *Job, path, format string) error {
+	cid, err := strconv.Atoi(j.task.SessionId)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	if format == "xml" {
+		data, err := fetchDanmakuXML(j.config.sessdata, cid)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(path, data, 0644)
+	}
+
+	duration := j.task.Duration
+	if duration <= 0 {
+		target := classifyURL(j.task.Url)
+		if view, err := fetchView(j.config.sessdata, target.aid, target.bvid); err == nil {
+			duration = view.pageDuration(cid)
+		}
+	}
+
+	// 优先使用分段弹幕, 失败时回退到 xml
+	list, err := fetchDanmakuSegments(j.config.sessdata, cid, duration)
+	if err != nil {
+		data, xmlErr := fetchDanmakuXML(j.config.sessdata, cid)
+		if xmlErr != nil {
+			return xmlErr
+		}
+		if list, err = parseDanmakuXML(data); err != nil {
+			return err
+		}
+	}
+
+	content := danmakuToASS(list, newDanmakuOptions(j.config), j.task.Title)
+	return os.WriteFile(path, []byte(content), 0644)
+}
+
+// 转换为 ass 字幕
+func danmakuToASS(list []danmaku, opts danmakuOptions, title string) string {
+	alpha := 255 - int(opts.opacity*255)
+	alpha = max(0, min(alpha, 255))
+
+	var sb strings.Builder
+	sb.WriteString(assHeader(title, fmt.Sprintf(
+		"Style: Danmaku,Microsoft YaHei,%d,&H%02XFFFFFF,&H%02XFFFFFF,&H%02X000000,&H%02X000000,0,0,0,0,100,100,0,0,1,1,0,7,0,0,0,1",
+		opts.fontSize, alpha, alpha, alpha, alpha,
+	)))
+
+	sorted := make([]danmaku, len(list))
+	copy(sorted, list)
+	sort.SliceStable(sorted, func(a, b int) bool {
+		return sorted[a].time < sorted[b].time
+	})
+
+	layout := newDanmakuLayout(opts)
+	for _, dm := range sorted {
+		if dm.content == "" || danmakuBlocked(dm.content, opts.keywords) {
+			continue
+		}
+
+		line, ok := layout.place(dm)
+		if !ok {
+			continue
+		}
+		sb.WriteString(line)
+	}
+	return sb.String()
+}
+
+func danmakuBlocked(content string, keywords []string) bool {
+	for _, keyword := range keywords {
+		if keyword != "" && strings.Contains(content, keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+// 弹幕排布, 避免同一行内重叠
+type danmakuLayout struct {
+	opts       danmakuOptions
+	rowHeight  int
+	scrollRows []danmakuSlot
+	topRows    []float64 // 每行空闲时间
+	bottomRows []float64
+	endTimes   []float64 // 屏幕上弹幕的消失时间
+}
+
+type danmakuSlot struct {
+	start float64
+	width float64
+}
+
+func newDanmakuLayout(opts danmakuOptions) *danmakuLayout {
+	rows := max(opts.height/opts.fontSize, 1)
+	return &danmakuLayout{
+		opts:       opts,
+		rowHeight:  opts.fontSize,
+		scrollRows: make([]danmakuSlot, rows),
+		topRows:    make([]float64, rows),
+		bottomRows: make([]float64, rows),
+	}
+}
+
+// 为弹幕分配位置, 返回 Dialogue 行
+func (l *danmakuLayout) place(dm danmaku) (string, bool) {
+	if dm.mode > 6 {
+		return "", false
+	}
+
+	// 同屏数量限制
+	alive := l.endTimes[:0]
+	for _, end := range l.endTimes {
+		if end > dm.time {
+			alive = append(alive, end)
+		}
+	}
+	l.endTimes = alive
+	if l.opts.maxOnScreen > 0 && len(l.endTimes) >= l.opts.maxOnScreen {
+		return "", false
+	}
+
+	fontSize := l.opts.fontSize
+	if dm.size > 0 {
+		fontSize = l.opts.fontSize * dm.size / 25
+	}
+	width := danmakuWidth(dm.content, fontSize)
+	w, h := float64(l.opts.width), float64(l.opts.height)
+
+	var tags string
+	var end float64
+	switch dm.mode {
+	case 4, 5:
+		rows := l.topRows
+		if dm.mode == 4 {
+			rows = l.bottomRows
+		}
+
+		row := -1
+		for i, free := range rows {
+			if free <= dm.time {
+				row = i
+				break
+			}
+		}
+		if row < 0 {
+			return "", false
+		}
+
+		end = dm.time + l.opts.staticDuration
+		rows[row] = end
+		if dm.mode == 5 {
+			tags = fmt.Sprintf(`\an8\pos(%d,%d)`, int(w/2), row*l.rowHeight)
+		} else {
+			tags = fmt.Sprintf(`\an2\pos(%d,%d)`, int(w/2), int(h)-row*l.rowHeight)
+		}
+	default:
+		duration := l.opts.scrollDuration
+		speed := (w + width) / duration
+
+		row := -1
+		for i, slot := range l.scrollRows {
+			if slot.width == 0 {
+				row = i
+				break
+			}
+			prevSpeed := (w + slot.width) / duration
+			// 前一条完全进入屏幕, 且本条到达左侧时前一条已离开
+			entered := slot.start+slot.width/prevSpeed <= dm.time
+			caught := dm.time+w/speed < slot.start+duration
+			if entered && !caught {
+				row = i
+				break
+			}
+		}
+		if row < 0 {
+			return "", false
+		}
+
+		end = dm.time + duration
+		l.scrollRows[row] = danmakuSlot{start: dm.time, width: width}
+		y := row * l.rowHeight
+		if dm.mode == 6 {
+			tags = fmt.Sprintf(`\move(%d,%d,%d,%d)`, -int(width), y, int(w), y)
+		} else {
+			tags = fmt.Sprintf(`\move(%d,%d,%d,%d)`, int(w), y, -int(width), y)
+		}
+	}
+
+	l.endTimes = append(l.endTimes, end)
+
+	if fontSize != l.opts.fontSize {
+		tags += fmt.Sprintf(`\fs%d`, fontSize)
+	}
+	if color := dm.color & 0xFFFFFF; color != 0xFFFFFF {
+		// ass 颜色顺序为 BGR
+		tags += fmt.Sprintf(`\c&H%02X%02X%02X&`, color&0xFF, color>>8&0xFF, color>>16)
+	}
+
+	return fmt.Sprintf("Dialogue: 2,%s,%s,Danmaku,,0,0,0,,{%s}%s\n",
+		formatSubtitleTime(dm.time, ".", 2),
+		formatSubtitleTime(end, ".", 2),
+		tags,
+		escapeASS(dm.content),
+	), true
+}
+
+// 估算弹幕宽度, 全角字符为一个字号, 半角为一半
+func danmakuWidth(content string, fontSize int) float64 {
+	var width float64
+	for _, r := range content {
+		if utf8.RuneLen(r) > 1 {
+			width += float64(fontSize)
+		} else {
+			width += float64(fontSize) / 2
+		}
+	}
+	return width
+}
+
+func escapeASS(content string) string {
+	return strings.NewReplacer(
+		`\`, `＼`,
+		"{", "｛",
+		"}", "｝",
+		"\r\n", `\N`,
+		"\n", `\N`,
+	).Replace(content)
+}
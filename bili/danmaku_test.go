@@ -0,0 +1,133 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func testDanmakuOptions() danmakuOptions {
+	return danmakuOptions{
+		fontSize:       48,
+		opacity:        0.5,
+		scrollDuration: 8,
+		staticDuration: 4,
+		width:          1920,
+		height:         1080,
+	}
+}
+
+func TestParseDanmakuXML(t *testing.T) {
+	data := `<?xml version="1.0" encoding="UTF-8"?><i><chatid>1</chatid>` +
+		`<d p="1.5,1,25,16777215,1700000000,0,abc,1,10">滚动</d>` +
+		`<d p="12.25,5,36,16711680,1700000000,0,abc,2,10">顶部</d></i>`
+
+	list, err := parseDanmakuXML([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 {
+		t.Fatalf("got %d danmaku, want 2", len(list))
+	}
+	if list[1].time != 12.25 || list[1].mode != 5 || list[1].size != 36 || list[1].color != 0xFF0000 || list[1].content != "顶部" {
+		t.Errorf("unexpected danmaku: %+v", list[1])
+	}
+}
+
+func TestParseDanmakuSegment(t *testing.T) {
+	var elem []byte
+	elem = protowire.AppendTag(elem, 1, protowire.VarintType)
+	elem = protowire.AppendVarint(elem, 42)
+	elem = protowire.AppendTag(elem, 2, protowire.VarintType)
+	elem = protowire.AppendVarint(elem, 2500)
+	elem = protowire.AppendTag(elem, 3, protowire.VarintType)
+	elem = protowire.AppendVarint(elem, 4)
+	elem = protowire.AppendTag(elem, 6, protowire.BytesType)
+	elem = protowire.AppendString(elem, "hash")
+	elem = protowire.AppendTag(elem, 7, protowire.BytesType)
+	elem = protowire.AppendString(elem, "底部弹幕")
+
+	var reply []byte
+	reply = protowire.AppendTag(reply, 1, protowire.BytesType)
+	reply = protowire.AppendBytes(reply, elem)
+
+	list, err := parseDanmakuSegment(reply)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 {
+		t.Fatalf("got %d danmaku, want 1", len(list))
+	}
+	if dm := list[0]; dm.time != 2.5 || dm.mode != 4 || dm.size != 25 || dm.color != 0xFFFFFF || dm.content != "底部弹幕" {
+		t.Errorf("unexpected danmaku: %+v", dm)
+	}
+}
+
+func TestDanmakuToASS(t *testing.T) {
+	list := []danmaku{
+		{time: 1, mode: 1, size: 25, color: 0xFFFFFF, content: "scroll"},
+		{time: 1, mode: 5, size: 25, color: 0xFF0000, content: "top"},
+		{time: 1, mode: 4, size: 25, color: 0xFFFFFF, content: "bottom"},
+		{time: 2, mode: 1, size: 25, color: 0xFFFFFF, content: "广告 blocked"},
+		{time: 3, mode: 7, size: 25, color: 0xFFFFFF, content: "advanced"},
+	}
+
+	opts := testDanmakuOptions()
+	opts.keywords = []string{"广告"}
+	got := danmakuToASS(list, opts, "title")
+
+	for _, want := range []string{
+		`Style: Danmaku,Microsoft YaHei,48,&H80FFFFFF`,
+		`Dialogue: 2,0:00:01.00,0:00:09.00,Danmaku,,0,0,0,,{\move(1920,0,-144,0)}scroll`,
+		`Dialogue: 2,0:00:01.00,0:00:05.00,Danmaku,,0,0,0,,{\an8\pos(960,0)\c&H0000FF&}top`,
+		`Dialogue: 2,0:00:01.00,0:00:05.00,Danmaku,,0,0,0,,{\an2\pos(960,1080)}bottom`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %q in\n%s", want, got)
+		}
+	}
+
+	for _, unwanted := range []string{"blocked", "advanced"} {
+		if strings.Contains(got, unwanted) {
+			t.Errorf("unexpected %q in output", unwanted)
+		}
+	}
+}
+
+func TestDanmakuLayoutRows(t *testing.T) {
+	layout := newDanmakuLayout(testDanmakuOptions())
+
+	// 同一时刻的滚动弹幕应分配到不同行
+	first, _ := layout.place(danmaku{time: 0, mode: 1, size: 25, content: "一二三"})
+	second, _ := layout.place(danmaku{time: 0, mode: 1, size: 25, content: "一二三"})
+	if !strings.Contains(first, `\move(1920,0,`) || !strings.Contains(second, `\move(1920,48,`) {
+		t.Errorf("unexpected rows:\n%s%s", first, second)
+	}
+
+	// 前一条离开后可复用第一行
+	third, _ := layout.place(danmaku{time: 10, mode: 1, size: 25, content: "一二三"})
+	if !strings.Contains(third, `\move(1920,0,`) {
+		t.Errorf("expected row reuse: %s", third)
+	}
+}
+
+func TestDanmakuDensity(t *testing.T) {
+	opts := testDanmakuOptions()
+	opts.maxOnScreen = 2
+	layout := newDanmakuLayout(opts)
+
+	placed := 0
+	for i := 0; i < 5; i++ {
+		if _, ok := layout.place(danmaku{time: 0, mode: 1, size: 25, content: "x"}); ok {
+			placed++
+		}
+	}
+	if placed != 2 {
+		t.Errorf("placed %d danmaku, want 2", placed)
+	}
+
+	if _, ok := layout.place(danmaku{time: 9, mode: 1, size: 25, content: "x"}); !ok {
+		t.Error("expected danmaku to be placed after the screen cleared")
+	}
+}
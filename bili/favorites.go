@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	pb "proto"
+)
+
+const favoritesPageSize = 20
+
+// 收藏夹内容
+type favoritesData struct {
+	Info struct {
+		ID         int    `json:"id"`
+		Title      string `json:"title"`
+		Cover      string `json:"cover"`
+		MediaCount int    `json:"media_count"`
+		Upper      struct {
+			Name string `json:"name"`
+		} `json:"upper"`
+	} `json:"info"`
+	Medias  []favoritesMedia `json:"medias"`
+	HasMore bool             `json:"has_more"`
+}
+
+type favoritesMedia struct {
+	ID    int    `json:"id"` // aid
+	Type  int    `json:"type"`
+	Title string `json:"title"`
+	Cover string `json:"cover"`
+	Page  int    `json:"page"`
+	Attr  int    `json:"attr"` // 0:正常 1:失效 9:UP主删除
+	Bvid  string `json:"bvid"`
+	Ugc   struct {
+		FirstCid int `json:"first_cid"`
+	} `json:"ugc"`
+}
+
+// 获取收藏夹全部内容
+func fetchFavorites(sessdata string, fid int) (*favoritesData, error) {
+	var favorites *favoritesData
+
+	for pn := 1; ; pn++ {
+		page, err := apiGet[favoritesData](sessdata, apiBase+"/x/v3/fav/resource/list", map[string]string{
+			"media_id": strconv.Itoa(fid),
+			"pn":       strconv.Itoa(pn),
+			"ps":       strconv.Itoa(favoritesPageSize),
+			"platform": "web",
+		})
+		if err != nil {
+			return nil, fmt.Errorf("获取收藏夹失败, err: %w", err)
+		}
+
+		if favorites == nil {
+			favorites = page
+		} else {
+			favorites.Medias = append(favorites.Medias, page.Medias...)
+		}
+
+		if !page.HasMore || len(page.Medias) == 0 {
+			return favorites, nil
+		}
+	}
+}
+
+// 收藏夹任务列表, 多P视频按分P展开
+func (s *server) favoritesTasks(favorites *favoritesData) []*pb.Task {
+	tasks := make([]*pb.Task, 0)
+
+	for _, media := range favorites.Medias {
+		// 失效视频与非视频内容保留为未选择的任务, 在标题与状态中说明原因
+		if media.Attr != 0 {
+			tasks = append(tasks, skippedTask(media, "已失效"))
+			continue
+		}
+		if media.Type != 2 {
+			tasks = append(tasks, skippedTask(media, "不是视频"))
+			continue
+		}
+
+		if media.Page <= 1 {
+			tasks = append(tasks, newTask(
+				media.Title,
+				"https://www.bilibili.com/video/"+media.Bvid,
+				strconv.Itoa(media.Ugc.FirstCid),
+				media.Cover,
+			))
+			continue
+		}
+
+		view, err := fetchView(s.config.sessdata, media.ID, media.Bvid)
+		if err != nil {
+			tasks = append(tasks, skippedTask(media, "获取分P失败: "+err.Error()))
+			continue
+		}
+
+		for _, page := range view.Pages {
+			tasks = append(tasks, newTask(
+				media.Title+" "+page.Part,
+				"https://www.bilibili.com/video/"+media.Bvid+"?p="+strconv.Itoa(page.Page),
+				strconv.Itoa(page.Cid),
+				media.Cover,
+			))
+		}
+	}
+
+	for _, task := range tasks {
+		task.Series = favorites.Info.Title
+	}
+	return tasks
+}
+
+// 跳过的任务在状态中带有该前缀, 解析时不会处理
+const skippedStatus = "已跳过: "
+
+// 无法下载的收藏, 默认不选择
+func skippedTask(media favoritesMedia, reason string) *pb.Task {
+	link := ""
+	if media.Bvid != "" {
+		link = videoURL(media.Bvid, 0)
+	}
+
+	task := newTask(media.Title+" ("+reason+")", link, strconv.Itoa(media.Ugc.FirstCid), media.Cover)
+	task.Status = skippedStatus + reason
+	return task
+}
+
+func isSkippedTask(task *pb.Task) bool {
+	return strings.HasPrefix(task.Status, skippedStatus)
+}
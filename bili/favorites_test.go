@@ -0,0 +1,51 @@
+package main
+
+import "testing"
+
+func TestClassifyFavorites(t *testing.T) {
+	for link, want := range map[string]int{
+		"https://space.bilibili.com/4279370/favlist?fid=1052622027&ftype=create": 1052622027,
+		"https://space.bilibili.com/4279370/favlist?ftype=create&fid=42":         42,
+		"https://www.bilibili.com/medialist/detail/ml1052622027":                 1052622027,
+		"https://www.bilibili.com/medialist/play/ml42?oid=1":                     42,
+		"https://space.bilibili.com/4279370/favlist":                             0,
+		"https://www.bilibili.com/video/BV1xx411c7mD":                            0,
+	} {
+		got := 0
+		if target := classifyURL(link); target.kind == linkFavorites {
+			got = target.id
+		}
+		if got != want {
+			t.Errorf("%s: got %d, want %d", link, got, want)
+		}
+	}
+}
+
+func TestFavoritesTasksReportsInvalid(t *testing.T) {
+	s := &server{config: NewConfig()}
+	favorites := &favoritesData{}
+	favorites.Info.Title = "参考"
+	favorites.Medias = []favoritesMedia{
+		{ID: 1, Type: 2, Title: "正常", Page: 1, Bvid: "BV1aa"},
+		{ID: 2, Type: 2, Title: "已失效视频", Page: 1, Attr: 9, Bvid: "BV1bb"},
+		{ID: 3, Type: 12, Title: "音频", Page: 1},
+	}
+
+	favorites.Medias[0].Ugc.FirstCid = 100
+
+	tasks := s.favoritesTasks(favorites)
+	if len(tasks) != 3 {
+		t.Fatalf("got %d tasks, want 3", len(tasks))
+	}
+	if tasks[0].SessionId != "100" || tasks[0].Series != "参考" || tasks[0].Status != "" {
+		t.Errorf("unexpected task: %v", tasks[0])
+	}
+
+	// 失效内容保留并说明原因
+	if tasks[1].Title != "已失效视频 (已失效)" || tasks[1].Status != "已跳过: 已失效" || tasks[1].Selected {
+		t.Errorf("unexpected task: %v", tasks[1])
+	}
+	if tasks[2].Status != "已跳过: 不是视频" || tasks[2].Series != "参考" {
+		t.Errorf("unexpected task: %v", tasks[2])
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	pb "proto"
+
+	ffmpeg_go "github.com/u2takey/ffmpeg-go"
+)
+
+var durationRegex = regexp.MustCompile(`Duration: (\d+):(\d+):(\d+(?:\.\d+)?)`)
+
+// 运行 ffmpeg 并回报进度, 任务停止时终止进程
+func (j *Job) runFFmpeg(out *ffmpeg_go.Stream, status string) error {
+	ctx, cancel := j.context()
+	defer cancel()
+
+	out = out.GlobalArgs("-progress", "pipe:1", "-nostats")
+	out.Context = ctx
+	out = out.OverWriteOutput()
+
+	if path, ok := ffmpegPath(j.config); ok {
+		out = out.SetFfmpegPath(path)
+	}
+
+	// 优先使用解析时得到的时长, 否则从 ffmpeg 输出中读取
+	var duration atomic.Int64
+	duration.Store(int64(time.Duration(j.task.Duration) * time.Second))
+
+	stdoutReader, stdoutWriter := io.Pipe()
+	stderrReader, stderrWriter := io.Pipe()
+	cmd := out.WithOutput(stdoutWriter, stderrWriter).Compile()
+
+	// TODO关闭cmd弹窗
+	// cmd.SysProcAttr = &syscall.SysProcAttr{HideWindow: true}
+
+	notify := NewDownloadNotification(j.stream)
+	var wg sync.WaitGroup
+	var lastLine string
+
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		parseFFmpegProgress(stdoutReader, func(elapsed time.Duration) {
+			total := time.Duration(duration.Load())
+			if total <= 0 {
+				return
+			}
+			notify.OnUpdate(&pb.Task{
+				Status:  status,
+				Cover:   j.task.Cover,
+				Percent: min(int64(elapsed*100/total), 99),
+			})
+		})
+	}()
+	go func() {
+		defer wg.Done()
+		scanner := bufio.NewScanner(stderrReader)
+		for scanner.Scan() {
+			line := scanner.Text()
+			if d, ok := parseFFmpegDuration(line); ok && duration.Load() <= 0 {
+				duration.Store(int64(d))
+			}
+			if strings.TrimSpace(line) != "" {
+				lastLine = line
+			}
+		}
+	}()
+
+	err := cmd.Run()
+	stdoutWriter.Close()
+	stderrWriter.Close()
+	wg.Wait()
+
+	select {
+	case <-j.stopChan:
+		return fmt.Errorf("任务已停止")
+	default:
+	}
+
+	if err != nil {
+		return fmt.Errorf("%s, %s", err.Error(), lastLine)
+	}
+
+	notify.OnUpdate(&pb.Task{
+		Status:  status,
+		Cover:   j.task.Cover,
+		Percent: 100,
+	})
+	return nil
+}
+
+// ffmpeg 可执行文件路径, 优先使用主机提供的路径
+func ffmpegPath(config *Config) (string, bool) {
+	if _, err := os.Stat(config.ffmpeg); err == nil {
+		return config.ffmpeg, true
+	}
+
+	if path, err := exec.LookPath("ffmpeg"); err == nil {
+		return path, true
+	}
+	return "", false
+}
+
+// 解析 -progress 输出, 每个进度块结束时回报已处理时长
+func parseFFmpegProgress(r io.Reader, onUpdate func(elapsed time.Duration)) {
+	scanner := bufio.NewScanner(r)
+	var elapsed time.Duration
+
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(strings.TrimSpace(scanner.Text()), "=")
+		if !ok {
+			continue
+		}
+
+		switch key {
+		// out_time_ms 实际单位也是微秒
+		case "out_time_us", "out_time_ms":
+			if us, err := strconv.ParseInt(value, 10, 64); err == nil && us >= 0 {
+				elapsed = time.Duration(us) * time.Microsecond
+			}
+		case "progress":
+			onUpdate(elapsed)
+		}
+	}
+}
+
+// 解析 ffmpeg 输入信息中的时长 e.g. "Duration: 00:03:21.50"
+func parseFFmpegDuration(line string) (time.Duration, bool) {
+	matches := durationRegex.FindStringSubmatch(line)
+	if len(matches) < 4 {
+		return 0, false
+	}
+
+	hours, _ := strconv.Atoi(matches[1])
+	minutes, _ := strconv.Atoi(matches[2])
+	seconds, _ := strconv.ParseFloat(matches[3], 64)
+
+	d := time.Duration(hours)*time.Hour +
+		time.Duration(minutes)*time.Minute +
+		time.Duration(seconds*float64(time.Second))
+	return d, d > 0
+}
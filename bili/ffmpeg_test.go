@@ -0,0 +1,43 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseFFmpegProgress(t *testing.T) {
+	output := `frame=120
+out_time_us=2500000
+out_time_ms=2500000
+progress=continue
+frame=240
+out_time_us=5000000
+progress=end
+`
+	var got []time.Duration
+	parseFFmpegProgress(strings.NewReader(output), func(elapsed time.Duration) {
+		got = append(got, elapsed)
+	})
+
+	want := []time.Duration{2500 * time.Millisecond, 5 * time.Second}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("update %d: got %v, want %v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestParseFFmpegDuration(t *testing.T) {
+	d, ok := parseFFmpegDuration("  Duration: 00:03:21.50, start: 0.000000, bitrate: 2138 kb/s")
+	if !ok || d != 3*time.Minute+21500*time.Millisecond {
+		t.Errorf("got %v %v", d, ok)
+	}
+
+	if _, ok := parseFFmpegDuration("Duration: N/A, bitrate: N/A"); ok {
+		t.Error("expected N/A duration to be ignored")
+	}
+}
@@ -6,6 +6,7 @@ require (
 	github.com/Yuelioi/bilibili v0.0.3
 	github.com/go-resty/resty/v2 v2.14.0
 	github.com/joho/godotenv v1.5.1
+	github.com/skip2/go-qrcode v0.0.0-20200617195104-da1b6568686e
 	github.com/u2takey/ffmpeg-go v0.5.0
 	google.golang.org/grpc v1.65.0
 	google.golang.org/protobuf v1.34.1
@@ -1,14 +1,13 @@
 package main
 
 import (
-	"context"
+	"errors"
 	"fmt"
-	"net/http"
 	"os"
 	"path/filepath"
-	"strconv"
 
-	"github.com/go-resty/resty/v2"
+	pb "proto"
+
 	ffmpeg_go "github.com/u2takey/ffmpeg-go"
 )
 
@@ -68,23 +67,13 @@ type VideoDownloader struct {
 }
 
 func (bh *VideoDownloader) Handle(j *Job, jm *JobManager) error {
-	req := resty.New().R().
-		SetHeader("Accept-Ranges", "bytes").
-		SetHeader("Referer", "https://www.bilibili.com/").
-		SetHeader("Range", "bytes=0-").
-		SetCookie(&http.Cookie{
-			Name:  "SESSDATA",
-			Value: j.config.sessdata,
-		}).SetDoNotParseResponse(true)
-
-	resp, err := req.Get(j.video.url)
-	if err != nil {
-		return fmt.Errorf("下载视频失败1, err: %s", err.Error())
+	if j.video.url == "" {
+		return errors.New("下载视频失败, err: 未选择视频格式")
 	}
 
-	contentLength, err := strconv.ParseInt(resp.Header().Get("Content-Length"), 10, 64)
+	contentLength, err := j.mediaLength(j.video)
 	if err != nil {
-		return fmt.Errorf("下载视频失败2, err: %s", err.Error())
+		return fmt.Errorf("下载视频失败1, err: %s", err.Error())
 	}
 
 	j.video.contentLength = contentLength
@@ -102,23 +91,13 @@ type AudioDownloader struct {
 }
 
 func (bh *AudioDownloader) Handle(j *Job, jm *JobManager) error {
-	req := resty.New().R().
-		SetHeader("Accept-Ranges", "bytes").
-		SetHeader("Referer", "https://www.bilibili.com/").
-		SetHeader("Range", "bytes=0-").
-		SetCookie(&http.Cookie{
-			Name:  "SESSDATA",
-			Value: j.config.sessdata,
-		}).SetDoNotParseResponse(true)
-
-	resp, err := req.Get(j.audio.url)
-	if err != nil {
-		return fmt.Errorf("下载音频失败1, err: %s", err.Error())
+	if j.audio.url == "" {
+		return errors.New("下载音频失败, err: 未选择音频格式")
 	}
 
-	contentLength, err := strconv.ParseInt(resp.Header().Get("Content-Length"), 10, 64)
+	contentLength, err := j.mediaLength(j.audio)
 	if err != nil {
-		return fmt.Errorf("下载视音频失败2, err: %s", err.Error())
+		return fmt.Errorf("下载音频失败1, err: %s", err.Error())
 	}
 
 	j.audio.contentLength = contentLength
@@ -131,29 +110,215 @@ func (bh *AudioDownloader) Handle(j *Job, jm *JobManager) error {
 	return bh.BaseHandler.Handle(j, jm)
 }
 
+// 下载字幕, 保存为外挂字幕或等待封装
+type SubtitleDownloader struct {
+	BaseHandler
+}
+
+func (bh *SubtitleDownloader) Handle(j *Job, jm *JobManager) error {
+	notify := NewDownloadNotification(j.stream)
+	downloaded := make([]*subtitleTrack, 0, len(j.subtitles))
+
+	for i, track := range j.subtitles {
+		notify.OnUpdate(&pb.Task{
+			Status:  "下载字幕中",
+			Cover:   j.task.Cover,
+			Percent: int64(i * 100 / len(j.subtitles)),
+		})
+
+		if err := downloadSubtitle(j.config.sessdata, track, j.config.subtitleFormat, j.task.Title); err != nil {
+			// 下载字幕失败, 不会停止下载任务
+			fmt.Printf("下载字幕失败, err: %s\n", err.Error())
+			continue
+		}
+		downloaded = append(downloaded, track)
+	}
+
+	j.subtitles = downloaded
+	return bh.BaseHandler.Handle(j, jm)
+}
+
+// 录制直播, 停止时结束当前分段
+type LiveRecorder struct {
+	BaseHandler
+}
+
+func (bh *LiveRecorder) Handle(j *Job, jm *JobManager) error {
+	recorder := &liveRecorder{
+		j:      j,
+		roomID: classifyURL(j.task.Url).id,
+		qn:     int(j.live.Id),
+	}
+	if err := recorder.run(); err != nil {
+		return fmt.Errorf("录制直播失败, err: %s", err.Error())
+	}
+	return bh.BaseHandler.Handle(j, jm)
+}
+
+// 下载歌词, 保存在音频旁
+type LyricDownloader struct {
+	BaseHandler
+}
+
+func (bh *LyricDownloader) Handle(j *Job, jm *JobManager) error {
+	if err := downloadLyric(j.lyric); err != nil {
+		// 下载歌词失败, 不会停止下载任务
+		fmt.Printf("下载歌词失败, err: %s\n", err.Error())
+	}
+	return bh.BaseHandler.Handle(j, jm)
+}
+
+// 下载弹幕, 保存在视频旁
+type DanmakuDownloader struct {
+	BaseHandler
+}
+
+func (bh *DanmakuDownloader) Handle(j *Job, jm *JobManager) error {
+	NewDownloadNotification(j.stream).OnUpdate(&pb.Task{
+		Status: "下载弹幕中",
+		Cover:  j.task.Cover,
+	})
+
+	workDir := filepath.Dir(j.task.Filepath)
+	pureTitle := sanitizeFileName(j.task.Title)
+	danmakuPath := filepath.Join(workDir, pureTitle+".danmaku."+j.danmaku.Code)
+
+	if err := downloadDanmaku(j, danmakuPath, j.danmaku.Code); err != nil {
+		// 下载弹幕失败, 不会停止下载任务
+		fmt.Printf("下载弹幕失败, err: %s\n", err.Error())
+	}
+	return bh.BaseHandler.Handle(j, jm)
+}
+
 type Combiner struct {
 	BaseHandler
 }
 
 func (bh *Combiner) Handle(j *Job, jm *JobManager) error {
 	input := []*ffmpeg_go.Stream{ffmpeg_go.Input(j.video.filepath), ffmpeg_go.Input(j.audio.filepath)}
-	out := ffmpeg_go.OutputContext(context.Background(), input, j.task.Filepath, ffmpeg_go.KwArgs{"c:v": "copy", "c:a": "aac"})
+	// 音频直接复制, 保留杜比全景声与无损音轨
+	kwargs := ffmpeg_go.KwArgs{"c:v": "copy", "c:a": "copy"}
+	if j.audioCodec == audioCodecFLAC {
+		// mp4 中的 flac 需要开启实验特性
+		kwargs["strict"] = "experimental"
+	}
 
-	_, err := os.Stat(j.config.ffmpeg)
-	if err == nil {
-		out = out.SetFfmpegPath(j.config.ffmpeg)
+	// 字幕作为软字幕流封装
+	if j.muxSubtitle && len(j.subtitles) > 0 {
+		for i, track := range j.subtitles {
+			input = append(input, ffmpeg_go.Input(track.filepath))
+			kwargs[fmt.Sprintf("metadata:s:s:%d", i)] = []string{
+				"language=" + track.iso639(),
+				"title=" + track.label,
+			}
+		}
+		kwargs["c:s"] = "mov_text"
 	}
 
-	// err = out.OverWriteOutput().WithOutput().Run()
+	out := ffmpeg_go.Output(input, j.task.Filepath, kwargs)
 
-	cmd := out.OverWriteOutput().Compile()
+	err := j.runFFmpeg(out, "合并中")
+	if err != nil {
+		return fmt.Errorf("合并失败, err: %s", err.Error())
+	}
+
+	if j.muxSubtitle {
+		for _, track := range j.subtitles {
+			os.Remove(track.filepath)
+		}
+	}
+	return bh.BaseHandler.Handle(j, jm)
+}
+
+// 仅下载音频时转封装或转码
+type AudioExtractor struct {
+	BaseHandler
+}
+
+func (bh *AudioExtractor) Handle(j *Job, jm *JobManager) error {
+	ext := filepath.Ext(j.task.Filepath)
+
+	// 没有 ffmpeg 时 m4s 可直接作为 m4a 使用
+	if _, ok := ffmpegPath(j.config); !ok {
+		if ext != ".m4a" {
+			return fmt.Errorf("转换音频失败, err: 转换为 %s 需要 ffmpeg", ext)
+		}
+		if err := moveFile(j.audio.filepath, j.task.Filepath); err != nil {
+			return fmt.Errorf("转换音频失败, err: %s", err.Error())
+		}
+		return bh.BaseHandler.Handle(j, jm)
+	}
 
-	// TODO关闭cmd弹窗
-	// cmd.SysProcAttr = &syscall.SysProcAttr{HideWindow: true}
+	input := []*ffmpeg_go.Stream{ffmpeg_go.Input(j.audio.filepath)}
+	out := ffmpeg_go.Output(input, j.task.Filepath, audioCodecArgs(ext, j.audioCodec))
+
+	if err := j.runFFmpeg(out, "转换音频中"); err != nil {
+		return fmt.Errorf("转换音频失败, err: %s", err.Error())
+	}
+
+	os.Remove(j.audio.filepath)
+	return bh.BaseHandler.Handle(j, jm)
+}
+
+// 写入标题/作者/日期等元数据与封面
+// 需要在合并后执行
+type MetadataWriter struct {
+	BaseHandler
+}
+
+func (bh *MetadataWriter) Handle(j *Job, jm *JobManager) error {
+	if j.meta == nil {
+		j.meta = loadMeta(j)
+	}
+
+	var err error
+	ext := filepath.Ext(j.task.Filepath)
+	if _, ok := ffmpegPath(j.config); ok {
+		err = j.meta.embedWithFFmpeg(j, j.task.Filepath, j.downloadVideo)
+	} else if ext == ".mp4" || ext == ".m4a" {
+		err = j.meta.embedWithAtoms(j.task.Filepath)
+	}
 
-	err = cmd.Run()
 	if err != nil {
-		return fmt.Errorf("合并失败, err: %s", err.Error())
+		// 写入元数据失败, 不影响已下载的文件
+		fmt.Printf("写入元数据失败, err: %s\n", err.Error())
+	}
+	return bh.BaseHandler.Handle(j, jm)
+}
+
+// 在视频旁保存互动视频剧情图
+type StoryGraphWriter struct {
+	BaseHandler
+}
+
+func (bh *StoryGraphWriter) Handle(j *Job, jm *JobManager) error {
+	bvid := classifyURL(j.task.Url).bvid
+	if err := writeStoryGraph(j.config.tmpDir, bvid, j.task.WorkDir); err != nil {
+		// 保存剧情图失败, 不影响已下载的文件
+		fmt.Printf("保存剧情图失败, err: %s\n", err.Error())
+	}
+	return bh.BaseHandler.Handle(j, jm)
+}
+
+// 下载完成后从稍后再看中移除, 多P视频在选中的分P全部完成后移除
+type WatchLaterRemover struct {
+	BaseHandler
+	pending *watchLaterTracker
+}
+
+func (bh *WatchLaterRemover) Handle(j *Job, jm *JobManager) error {
+	target := classifyURL(j.task.Url)
+	if !bh.pending.done(target.bvid, j.task.SessionId) {
+		return bh.BaseHandler.Handle(j, jm)
+	}
+
+	view, err := fetchView(j.config.sessdata, target.aid, target.bvid)
+	if err == nil {
+		err = removeWatchLater(j.config.sessdata, j.config.biliJct, view.Aid)
+	}
+	if err != nil {
+		// 移除失败, 不影响已下载的文件
+		fmt.Printf("移除稍后再看失败, err: %s\n", err.Error())
 	}
 	return bh.BaseHandler.Handle(j, jm)
 }
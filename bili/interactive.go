@@ -0,0 +1,211 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	pb "proto"
+)
+
+// 剧情图最多节点数, 防止异常数据无限展开
+const maxStoryNodes = 500
+
+// 互动视频节点信息
+type edgeInfoData struct {
+	Title  string `json:"title"`
+	EdgeID int    `json:"edge_id"`
+	Edges  struct {
+		Questions []struct {
+			Choices []struct {
+				ID     int    `json:"id"` // 目标节点
+				Cid    int    `json:"cid"`
+				Option string `json:"option"`
+			} `json:"choices"`
+		} `json:"questions"`
+	} `json:"edges"`
+}
+
+// 互动视频剧情图, 保存为 json 与 dot
+type storyGraph struct {
+	Aid          int         `json:"aid"`
+	Bvid         string      `json:"bvid"`
+	Title        string      `json:"title"`
+	GraphVersion int         `json:"graph_version"`
+	Nodes        []storyNode `json:"nodes"`
+	Edges        []storyEdge `json:"edges"`
+}
+
+type storyNode struct {
+	ID    int      `json:"id"`
+	Cid   int      `json:"cid"`
+	Title string   `json:"title"`
+	Path  []string `json:"path"` // 从起点到该节点的选项
+}
+
+type storyEdge struct {
+	From   int    `json:"from"`
+	To     int    `json:"to"`
+	Option string `json:"option"`
+}
+
+// 遍历互动视频剧情图, 按广度优先记录到达每个节点的最短选择路径
+func fetchStoryGraph(sessdata string, view *viewData) (*storyGraph, error) {
+	if len(view.Pages) == 0 {
+		return nil, errors.New("互动视频没有分P")
+	}
+	rootCid := view.Pages[0].Cid
+
+	player, err := apiGet[playerData](sessdata, apiBase+"/x/player/v2", map[string]string{
+		"aid": strconv.Itoa(view.Aid),
+		"cid": strconv.Itoa(rootCid),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("获取剧情图版本失败, err: %w", err)
+	}
+
+	graph := &storyGraph{
+		Aid:          view.Aid,
+		Bvid:         view.Bvid,
+		Title:        view.Title,
+		GraphVersion: player.Interaction.GraphVersion,
+	}
+
+	fetch := func(edgeID int) (*edgeInfoData, error) {
+		params := map[string]string{
+			"aid":           strconv.Itoa(view.Aid),
+			"graph_version": strconv.Itoa(graph.GraphVersion),
+		}
+		// 不指定节点时返回起点
+		if edgeID != 0 {
+			params["edge_id"] = strconv.Itoa(edgeID)
+		}
+		return apiGet[edgeInfoData](sessdata, apiBase+"/x/stein/edgeinfo_v2", params)
+	}
+
+	return graph, graph.walk(fetch, rootCid)
+}
+
+func (g *storyGraph) walk(fetch func(edgeID int) (*edgeInfoData, error), rootCid int) error {
+	type pending struct {
+		id   int
+		cid  int
+		path []string
+	}
+
+	queue := []pending{{cid: rootCid}}
+	visited := map[int]bool{}
+
+	for len(queue) > 0 && len(g.Nodes) < maxStoryNodes {
+		current := queue[0]
+		queue = queue[1:]
+
+		info, err := fetch(current.id)
+		if err != nil {
+			return fmt.Errorf("获取剧情节点失败, err: %w", err)
+		}
+
+		id := current.id
+		if id == 0 {
+			id = info.EdgeID
+			visited[id] = true
+		}
+
+		g.Nodes = append(g.Nodes, storyNode{ID: id, Cid: current.cid, Title: info.Title, Path: current.path})
+
+		for _, question := range info.Edges.Questions {
+			for _, choice := range question.Choices {
+				g.Edges = append(g.Edges, storyEdge{From: id, To: choice.ID, Option: choice.Option})
+				if visited[choice.ID] {
+					continue
+				}
+				visited[choice.ID] = true
+
+				path := append(append([]string{}, current.path...), choice.Option)
+				queue = append(queue, pending{id: choice.ID, cid: choice.Cid, path: path})
+			}
+		}
+	}
+	return nil
+}
+
+// 每个节点一个任务, 标题包含选择路径, 相同 cid 只保留一次
+func (g *storyGraph) tasks(cover string) []*pb.Task {
+	tasks := make([]*pb.Task, 0, len(g.Nodes))
+	seen := map[int]bool{}
+
+	for _, node := range g.Nodes {
+		if seen[node.Cid] {
+			continue
+		}
+		seen[node.Cid] = true
+
+		title := g.Title
+		if len(node.Path) > 0 {
+			title += " " + strings.Join(node.Path, " > ")
+		}
+
+		task := newTask(title, videoURL(g.Bvid, 0), strconv.Itoa(node.Cid), cover)
+		task.Series = g.Title
+		task.Section = node.Title
+		tasks = append(tasks, task)
+	}
+	return tasks
+}
+
+// graphviz 描述
+func (g *storyGraph) dot() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "digraph %s {\n", strconv.Quote(g.Title))
+	for _, node := range g.Nodes {
+		fmt.Fprintf(&sb, "  n%d [label=%s];\n", node.ID, strconv.Quote(node.Title))
+	}
+	for _, edge := range g.Edges {
+		fmt.Fprintf(&sb, "  n%d -> n%d [label=%s];\n", edge.From, edge.To, strconv.Quote(edge.Option))
+	}
+	sb.WriteString("}\n")
+	return sb.String()
+}
+
+// 剧情图缓存路径, 下载时复制到任务目录
+func storyGraphCachePath(tmpDir, bvid string) string {
+	return filepath.Join(tmpDir, "graph", bvid+".json")
+}
+
+func (g *storyGraph) save(path string) error {
+	data, err := json.MarshalIndent(g, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// 在任务目录写入剧情图 json 与 dot, 已存在时跳过
+func writeStoryGraph(tmpDir, bvid, workDir string) error {
+	data, err := os.ReadFile(storyGraphCachePath(tmpDir, bvid))
+	if err != nil {
+		return err
+	}
+
+	var graph storyGraph
+	if err := json.Unmarshal(data, &graph); err != nil {
+		return err
+	}
+
+	base := filepath.Join(workDir, sanitizeFileName(graph.Title)+".graph")
+	if _, err := os.Stat(base + ".json"); err == nil {
+		return nil
+	}
+
+	if err := os.WriteFile(base+".json", data, 0644); err != nil {
+		return err
+	}
+	return os.WriteFile(base+".dot", []byte(graph.dot()), 0644)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// 起点 1 -> A:2 / B:3, 2 -> 3, 3 为结局
+var storyEdges = map[int]string{
+	0: `{"title": "开始", "edge_id": 1, "edges": {"questions": [{"choices": [
+		{"id": 2, "cid": 20, "option": "A"},
+		{"id": 3, "cid": 30, "option": "B"}
+	]}]}}`,
+	2: `{"title": "分支A", "edge_id": 2, "edges": {"questions": [{"choices": [
+		{"id": 3, "cid": 30, "option": "继续"},
+		{"id": 1, "cid": 10, "option": "重来"}
+	]}]}}`,
+	3: `{"title": "结局", "edge_id": 3}`,
+}
+
+func testStoryGraph(t *testing.T) *storyGraph {
+	graph := &storyGraph{Aid: 1, Bvid: "BV1xx411c7mD", Title: "互动"}
+	err := graph.walk(func(edgeID int) (*edgeInfoData, error) {
+		var info edgeInfoData
+		err := json.Unmarshal([]byte(storyEdges[edgeID]), &info)
+		return &info, err
+	}, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return graph
+}
+
+func TestStoryGraphWalk(t *testing.T) {
+	graph := testStoryGraph(t)
+
+	if len(graph.Nodes) != 3 || len(graph.Edges) != 4 {
+		t.Fatalf("got %d nodes %d edges", len(graph.Nodes), len(graph.Edges))
+	}
+
+	tasks := graph.tasks("")
+	if len(tasks) != 3 {
+		t.Fatalf("got %d tasks, want 3", len(tasks))
+	}
+	if tasks[0].Title != "互动" || tasks[0].SessionId != "10" {
+		t.Errorf("unexpected root task: %v", tasks[0])
+	}
+	if tasks[2].Title != "互动 B" || tasks[2].SessionId != "30" || tasks[2].Section != "结局" {
+		t.Errorf("unexpected ending task: %v", tasks[2])
+	}
+}
+
+func TestWriteStoryGraph(t *testing.T) {
+	graph := testStoryGraph(t)
+	tmpDir, workDir := t.TempDir(), t.TempDir()
+
+	if err := graph.save(storyGraphCachePath(tmpDir, graph.Bvid)); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeStoryGraph(tmpDir, graph.Bvid, workDir); err != nil {
+		t.Fatal(err)
+	}
+
+	dot, err := os.ReadFile(filepath.Join(workDir, "互动.graph.dot"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(dot), `n1 -> n2 [label="A"];`) {
+		t.Errorf("unexpected dot:\n%s", dot)
+	}
+	if _, err := os.Stat(filepath.Join(workDir, "互动.graph.json")); err != nil {
+		t.Error(err)
+	}
+}
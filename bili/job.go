@@ -1,6 +1,8 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -9,17 +11,19 @@ import (
 	"os"
 	"path/filepath"
 	pb "proto"
+	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
-
-	"github.com/go-resty/resty/v2"
 )
 
 const (
 	bufferSize   = 1024 * 256      // 500kb buffer size
 	chunkSize    = 5 * 1024 * 1024 // 5MB chunk size
 	timeInterval = 1333            // 任务更新周期
+
+	maxChunkRetries = 3 // 分块最多重试次数
 )
 
 var (
@@ -28,16 +32,23 @@ var (
 )
 
 type JobManager struct {
+	mu   sync.Mutex
 	jobs map[string]*Job
 }
 
 type Media struct {
 	mediaType      string        // 媒体类型  视频/音频
 	url            string        // 下载链接
+	backups        []string      // 备用链接, 当前链接失败时切换
 	filepath       string        // 临时储存路径
 	contentLength  int64         // 长度(bytes)
 	file           *os.File      // 文件
 	totalBytesRead *atomic.Int64 // 已读
+	doneChan       chan struct{} // 下载结束通道
+	formatID       int64         // 格式 ID, 用于刷新过期链接
+	codec          string        // 格式编码
+	sessdata       string        // 获取当前链接的账号, 下载时使用
+	mu             sync.Mutex    // 保护 url, backups 与 sessdata
 }
 
 func NewJobManager() *JobManager {
@@ -50,24 +61,57 @@ func NewJobManager() *JobManager {
 }
 
 func (jm *JobManager) AddJob(job *Job) {
+	jm.mu.Lock()
+	defer jm.mu.Unlock()
 	jm.jobs[job.task.Id] = job
 }
 
+func (jm *JobManager) GetJob(id string) (*Job, bool) {
+	jm.mu.Lock()
+	defer jm.mu.Unlock()
+	job, ok := jm.jobs[id]
+	return job, ok
+}
+
+func (jm *JobManager) RemoveJob(id string) {
+	jm.mu.Lock()
+	defer jm.mu.Unlock()
+	delete(jm.jobs, id)
+}
+
 // 一整个下载任务
 type Job struct {
 	stopChan   chan struct{} //  停止通道
+	stopOnce   sync.Once
 	finishChan chan struct{} // 完成通道
 	config     *Config
+	accounts   []account // 刷新链接时按顺序使用的账号
 
 	stream pb.DownloadService_DownloadServer
 	video  *Media
 	audio  *Media
 	task   *pb.Task
+	meta   *mediaMeta // 输出文件元数据
+
+	downloadVideo bool
+	downloadAudio bool
+	audioCodec    string // 所选音轨编码
+
+	subtitles   []*subtitleTrack // 字幕
+	muxSubtitle bool             // 是否封装字幕
+	danmaku     *pb.Format       // 弹幕格式
+	lyric       *lyricTrack      // 歌词
+	live        *pb.Format       // 直播画质
 }
 
 func NewJob(stream pb.DownloadService_DownloadServer, task *pb.Task, config *Config) (*Job, error) {
 	v := &pb.Format{}
 	a := &pb.Format{}
+	var subs []*pb.Format
+	var dm *pb.Format
+	var lrc *pb.Format
+	var live *pb.Format
+	var output string
 
 	for _, seg := range task.Segments {
 		if seg.MimeType == "video" {
@@ -76,6 +120,13 @@ func NewJob(stream pb.DownloadService_DownloadServer, task *pb.Task, config *Con
 					v = fm
 				}
 			}
+
+			// 主机未选择时按策略选择
+			if !hasSelected(seg.Formats) {
+				if fm := config.selection.selectVideo(seg.Formats); fm != nil {
+					v = fm
+				}
+			}
 		}
 
 		if seg.MimeType == "audio" {
@@ -84,17 +135,138 @@ func NewJob(stream pb.DownloadService_DownloadServer, task *pb.Task, config *Con
 					a = fm
 				}
 			}
+
+			if !hasSelected(seg.Formats) {
+				if fm := config.selection.selectAudio(seg.Formats); fm != nil {
+					a = fm
+				}
+			}
+		}
+
+		// 字幕可多选, 未选择时使用第一种语言
+		if seg.MimeType == "subtitle" && len(seg.Formats) > 0 {
+			for _, fm := range seg.Formats {
+				if fm.Selected {
+					subs = append(subs, fm)
+				}
+			}
+			if len(subs) == 0 {
+				subs = append(subs, seg.Formats[0])
+			}
+		}
+
+		if seg.MimeType == "output" {
+			for _, fm := range seg.Formats {
+				if fm.Selected {
+					output = fm.Code
+				}
+			}
+		}
+
+		// 直播未选择画质时使用第一个
+		if seg.MimeType == "live" && len(seg.Formats) > 0 {
+			live = seg.Formats[0]
+			for _, fm := range seg.Formats {
+				if fm.Selected {
+					live = fm
+				}
+			}
+		}
+
+		if seg.MimeType == "lyric" {
+			for _, fm := range seg.Formats {
+				if fm.Selected {
+					lrc = fm
+				}
+			}
+		}
+
+		// 弹幕未选择时默认转换为 ass
+		if seg.MimeType == "danmaku" && len(seg.Formats) > 0 {
+			dm = seg.Formats[0]
+			for _, fm := range seg.Formats {
+				if fm.Selected {
+					dm = fm
+				}
+			}
+		}
+	}
+
+	// 需要登录或大会员的格式没有下载链接
+	if v.Id != 0 && v.Url == "" {
+		return nil, errors.New("所选格式需要登录或大会员")
+	}
+
+	// 输出格式, 任务未指定时使用设置
+	downloadVideo, downloadAudio := config.downloadVideo, config.downloadAudio
+	audioFormat := config.audioFormat
+	switch {
+	case output == outputVideo:
+		downloadVideo, downloadAudio = true, true
+	case isAudioFormat(output):
+		downloadVideo, downloadAudio = false, true
+		audioFormat = output
+	}
+
+	// 直播由录制器单独处理
+	if live != nil {
+		downloadVideo, downloadAudio = false, false
+	}
+
+	ext := ".mp4"
+	if downloadAudio && !downloadVideo {
+		_, hasFFmpeg := ffmpegPath(config)
+		if availableAudioFormat(audioFormat, hasFFmpeg) != audioFormat {
+			return nil, fmt.Errorf("输出为 %s 需要 ffmpeg", audioFormat)
 		}
+		ext = audioExtension(audioFormat, a.Code, hasFFmpeg)
 	}
 
 	downloadDir := filepath.Join(config.tmpDir, "downloading")
 
 	pureTitle := sanitizeFileName(task.Title)
-	vPath := filepath.Join(downloadDir, pureTitle+".video.tmp.mp4")
-	aPath := filepath.Join(downloadDir, pureTitle+".audio.tmp.mp3")
-	targetPath := filepath.Join(task.WorkDir, pureTitle+".mp4")
+	vPath := filepath.Join(downloadDir, pureTitle+".video.tmp.m4s")
+	aPath := filepath.Join(downloadDir, pureTitle+".audio.tmp.m4s")
+	targetPath := filepath.Join(task.WorkDir, pureTitle+ext)
 	task.Filepath = targetPath
 
+	// 仅下载视频时直接保存到目标路径
+	if downloadVideo && !downloadAudio {
+		vPath = targetPath
+	}
+
+	// 只有合并音视频时才能封装字幕
+	muxSubtitle := config.muxSubtitle && downloadVideo && downloadAudio
+
+	subtitles := make([]*subtitleTrack, 0, len(subs))
+	for _, fm := range subs {
+		// 封装时先保存到临时目录
+		subDir := task.WorkDir
+		if muxSubtitle {
+			subDir = downloadDir
+		}
+
+		subtitles = append(subtitles, &subtitleTrack{
+			lang:     fm.Code,
+			label:    fm.Label,
+			url:      fm.Url,
+			filepath: filepath.Join(subDir, pureTitle+"."+fm.Code+"."+config.subtitleFormat),
+		})
+	}
+
+	// 歌词保存在音频旁
+	var lyric *lyricTrack
+	if lrc != nil && lrc.Url != "" {
+		lyric = &lyricTrack{
+			url:      lrc.Url,
+			filepath: filepath.Join(task.WorkDir, pureTitle+".lrc"),
+		}
+	}
+
+	// 按 CDN 策略排列候选链接
+	vLinks := config.cdn.apply(append([]string{v.Url}, v.BackupUrls...))
+	aLinks := config.cdn.apply(append([]string{a.Url}, a.BackupUrls...))
+
 	return &Job{
 		stopChan:   make(chan struct{}),
 		finishChan: make(chan struct{}),
@@ -102,22 +274,60 @@ func NewJob(stream pb.DownloadService_DownloadServer, task *pb.Task, config *Con
 		config:     config,
 		video: &Media{
 			mediaType:      "视频",
-			url:            v.Url,
+			url:            vLinks[0],
+			backups:        vLinks[1:],
 			filepath:       vPath,
 			file:           &os.File{},
 			totalBytesRead: &atomic.Int64{},
+			doneChan:       make(chan struct{}),
+			formatID:       v.Id,
+			codec:          v.Code,
+			sessdata:       config.sessdata,
 		},
 		audio: &Media{
 			mediaType:      "音频",
-			url:            a.Url,
+			url:            aLinks[0],
+			backups:        aLinks[1:],
 			filepath:       aPath,
 			file:           &os.File{},
 			totalBytesRead: &atomic.Int64{},
+			doneChan:       make(chan struct{}),
+			formatID:       a.Id,
+			codec:          a.Code,
+			sessdata:       config.sessdata,
 		},
-		task: task,
+		task:          task,
+		downloadVideo: downloadVideo,
+		downloadAudio: downloadAudio,
+		audioCodec:    a.Code,
+		subtitles:     subtitles,
+		muxSubtitle:   muxSubtitle,
+		danmaku:       dm,
+		lyric:         lyric,
+		live:          live,
 	}, nil
 }
 
+// 停止任务, 可重复调用
+func (j *Job) stop() {
+	j.stopOnce.Do(func() {
+		close(j.stopChan)
+	})
+}
+
+// 创建随任务停止而取消的上下文
+func (j *Job) context() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		select {
+		case <-j.stopChan:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
 func autoSetBatchSize(contentLength int64) int64 {
 	minBatchSize := int64(2)
 	maxBatchSize := int64(5)
@@ -130,6 +340,7 @@ func autoSetBatchSize(contentLength int64) int64 {
 // 监控任务进度
 func (j *Job) monitor(m *Media) {
 	ticker := time.NewTicker(time.Duration(timeInterval) * time.Millisecond)
+	defer ticker.Stop()
 	notify := NewDownloadNotification(j.stream)
 
 	var previousBytesRead int64
@@ -149,19 +360,22 @@ func (j *Job) monitor(m *Media) {
 				Percent: (currentBytesRead * 100 / m.contentLength),
 			}
 
-			fmt.Printf("progressMsg: %v\n", progressMsg)
 			notify.OnUpdate(progressMsg)
 			// 如果没关闭
+		case <-m.doneChan:
+			return
 		case <-j.stopChan:
-			ticker.Stop()
+			return
 		case <-j.finishChan:
-			ticker.Stop()
+			return
 		}
 	}
 
 }
 
 func (j *Job) download(m *Media) error {
+	defer close(m.doneChan)
+
 	batchSize := autoSetBatchSize(m.contentLength)
 	chunkSize := m.contentLength / batchSize
 	if chunkSize*batchSize < m.contentLength {
@@ -176,6 +390,8 @@ func (j *Job) download(m *Media) error {
 	defer m.file.Close()
 
 	var wg sync.WaitGroup
+	var errOnce sync.Once
+	var chunkErr error
 
 	for i := int64(0); i < batchSize; i++ {
 		start := i * chunkSize
@@ -188,55 +404,112 @@ func (j *Job) download(m *Media) error {
 		go func(chunkStart, chunkEnd int64) {
 			defer wg.Done()
 			if err := j.downloadChunk(chunkStart, chunkEnd, m); err != nil {
-				return
+				errOnce.Do(func() { chunkErr = err })
 			}
 		}(start, end)
 	}
 	wg.Wait()
 
-	return nil
+	select {
+	case <-j.stopChan:
+		return fmt.Errorf("任务已停止")
+	default:
+	}
+	return chunkErr
 }
 
+// 下载分块, 链接过期时刷新, 节点出错或停滞时切换备用链接, 从当前位置重试
 func (j *Job) downloadChunk(chunkStart, chunkEnd int64, m *Media) error {
+	for attempt := 0; ; attempt++ {
+		link, sessdata := m.current()
+		err := j.downloadRange(link, sessdata, &chunkStart, chunkEnd, m)
+		if err == nil || attempt >= maxChunkRetries+m.backupCount() {
+			return err
+		}
+
+		select {
+		case <-j.stopChan:
+			return err
+		default:
+		}
+
+		if errors.Is(err, errStreamExpired) {
+			if _, err := j.renewURL(m, link); err != nil {
+				return err
+			}
+		} else {
+			m.failover(link)
+		}
+		log.Printf("分块 %d-%d 下载中断, 重试: %v", chunkStart, chunkEnd, err)
+	}
+}
 
-	req := resty.New().R().
+// 下载 [offset, chunkEnd] 范围, offset 随写入前进
+func (j *Job) downloadRange(link, sessdata string, offset *int64, chunkEnd int64, m *Media) error {
+	if *offset > chunkEnd {
+		return nil
+	}
+
+	// 长时间没有数据时中断连接
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stall := time.AfterFunc(stallTimeout, cancel)
+	defer stall.Stop()
+
+	req := newRequest(sessdata).
+		SetContext(ctx).
 		SetHeader("Accept-Ranges", "bytes").
-		SetHeader("Range", fmt.Sprintf("bytes=%d-%d", chunkStart, chunkEnd)).
-		SetHeader("Referer", "https://www.bilibili.com/").
-		SetCookie(&http.Cookie{
-			Name:  "SESSDATA",
-			Value: j.config.sessdata,
-		}).SetDoNotParseResponse(true)
-
-	resp, err := req.Get(m.url)
+		SetHeader("Range", fmt.Sprintf("bytes=%d-%d", *offset, chunkEnd)).
+		SetDoNotParseResponse(true)
+
+	resp, err := req.Get(link)
 	if err != nil {
 		log.Println("请求失败:", err)
 		return err
 	}
 	defer resp.RawBody().Close()
 
+	// 过期链接返回 403/404, 错误页面不能写入文件
+	switch resp.StatusCode() {
+	case http.StatusPartialContent:
+		if start, ok := contentRangeStart(resp.Header().Get("Content-Range")); !ok || start != *offset {
+			return errStreamExpired
+		}
+	case http.StatusForbidden, http.StatusNotFound, http.StatusGone:
+		return errStreamExpired
+	default:
+		return fmt.Errorf("请求失败: %s", resp.Status())
+	}
+
 	buffer := make([]byte, bufferSize)
 
 	for {
 		select {
 		case <-j.stopChan:
 			fmt.Println("Context canceled")
-			return fmt.Errorf("download stopped for chunk %d-%d", chunkStart, chunkEnd)
+			return fmt.Errorf("download stopped for chunk %d-%d", *offset, chunkEnd)
 
 		default:
 			n, err := io.ReadFull(resp.RawBody(), buffer)
+			if ctx.Err() != nil {
+				err = errStreamStalled
+			}
+			stall.Reset(stallTimeout)
 			if n > 0 {
-				_, writeErr := m.file.WriteAt(buffer[:n], chunkStart)
+				_, writeErr := m.file.WriteAt(buffer[:n], *offset)
 				if writeErr != nil {
 					log.Printf("写入文件失败：%v", writeErr)
 					return writeErr
 				}
-				chunkStart += int64(n)
+				*offset += int64(n)
 				m.totalBytesRead.Add(int64(n))
 			}
 
 			if err != nil {
-				if err == io.EOF {
+				if err == io.EOF || err == io.ErrUnexpectedEOF {
+					if *offset <= chunkEnd {
+						return io.ErrUnexpectedEOF
+					}
 					return nil // 读取完毕，正常退出
 				}
 
@@ -245,3 +518,17 @@ func (j *Job) downloadChunk(chunkStart, chunkEnd int64, m *Media) error {
 		}
 	}
 }
+
+// 解析 Content-Range 的起始位置 e.g. bytes 0-499/1234
+func contentRangeStart(value string) (int64, bool) {
+	value, ok := strings.CutPrefix(value, "bytes ")
+	if !ok {
+		return 0, false
+	}
+	start, _, ok := strings.Cut(value, "-")
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(start, 10, 64)
+	return n, err == nil
+}
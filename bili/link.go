@@ -0,0 +1,111 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// 短链接域名
+var shortLinkHosts = map[string]bool{
+	"b23.tv":      true,
+	"bili2233.cn": true,
+}
+
+// 需要保留的参数, 其余均为分享/统计参数
+var keptQueryParams = map[string]bool{
+	"p":       true, // 分P
+	"t":       true, // 分享时的播放位置(秒)
+	"fid":     true, // 收藏夹
+	"tid":     true, // 投稿分区
+	"keyword": true, // 投稿关键词
+}
+
+const maxRedirects = 5
+
+// 规范化链接: 展开短链接, 转换移动端链接, 去除分享参数
+func normalizeURL(link string) (string, error) {
+	link = strings.TrimSpace(link)
+	if !strings.Contains(link, "://") {
+		link = "https://" + link
+	}
+
+	u, err := url.Parse(link)
+	if err != nil {
+		return "", fmt.Errorf("链接格式错误: %s", link)
+	}
+
+	for i := 0; shortLinkHosts[u.Hostname()]; i++ {
+		if i >= maxRedirects {
+			return "", fmt.Errorf("短链接跳转次数过多: %s", link)
+		}
+		if u, err = resolveShortLink(u); err != nil {
+			return "", fmt.Errorf("解析短链接失败, err: %w", err)
+		}
+	}
+
+	switch u.Hostname() {
+	case "m.bilibili.com":
+		// e.g. m.bilibili.com/space/123
+		if rest, ok := strings.CutPrefix(u.Path, "/space/"); ok {
+			u.Host = "space.bilibili.com"
+			u.Path = "/" + rest
+		} else {
+			u.Host = "www.bilibili.com"
+		}
+	case "bilibili.com":
+		u.Host = "www.bilibili.com"
+	}
+	u.Scheme = "https"
+	u.Fragment = ""
+
+	query := u.Query()
+	for key := range query {
+		if !keptQueryParams[key] {
+			query.Del(key)
+		}
+	}
+	u.RawQuery = query.Encode()
+
+	normalized := u.String()
+	if !supportedURL(normalized) {
+		return "", fmt.Errorf("不支持的链接: %s", link)
+	}
+	return normalized, nil
+}
+
+// 获取短链接跳转地址
+func resolveShortLink(u *url.URL) (*url.URL, error) {
+	client := &http.Client{
+		Timeout: 10 * time.Second,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", userAgent)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	location := resp.Header.Get("Location")
+	if location == "" {
+		return nil, errors.New("短链接无效或已过期")
+	}
+	return u.Parse(location)
+}
+
+// 是否为插件支持的链接
+func supportedURL(link string) bool {
+	return classifyURL(link).kind != linkUnknown
+}
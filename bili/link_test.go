@@ -0,0 +1,58 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestNormalizeURL(t *testing.T) {
+	for link, want := range map[string]string{
+		"https://www.bilibili.com/video/BV1xx411c7mD?spm_id_from=333.1007&vd_source=abc":       "https://www.bilibili.com/video/BV1xx411c7mD",
+		"https://m.bilibili.com/video/BV1xx411c7mD?p=2&t=30&share_source=copy_web":             "https://www.bilibili.com/video/BV1xx411c7mD?p=2&t=30",
+		"https://www.bilibili.com/video/BV1xx411c7mD?t=125.6&vd_source=abc":                    "https://www.bilibili.com/video/BV1xx411c7mD?t=125.6",
+		"www.bilibili.com/video/av170001/":                                                     "https://www.bilibili.com/video/av170001/",
+		"https://bilibili.com/video/BV1xx411c7mD#reply123":                                     "https://www.bilibili.com/video/BV1xx411c7mD",
+		"https://m.bilibili.com/bangumi/play/ep374717?share_from=ogv":                          "https://www.bilibili.com/bangumi/play/ep374717",
+		"https://m.bilibili.com/space/4279370":                                                 "https://space.bilibili.com/4279370",
+		"https://space.bilibili.com/4279370/favlist?fid=1052622027&ftype=create&spm_id_from=1": "https://space.bilibili.com/4279370/favlist?fid=1052622027",
+	} {
+		got, err := normalizeURL(link)
+		if err != nil {
+			t.Errorf("%s: %v", link, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("%s: got %s, want %s", link, got, want)
+		}
+	}
+}
+
+func TestNormalizeURLUnsupported(t *testing.T) {
+	for _, link := range []string{
+		"https://www.bilibili.com/",
+		"https://live.bilibili.com/",
+		"https://example.com/video/",
+	} {
+		if _, err := normalizeURL(link); err == nil {
+			t.Errorf("%s: expected error", link)
+		}
+	}
+}
+
+func TestResolveShortLink(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "https://www.bilibili.com/video/BV1xx411c7mD?share_source=copy", http.StatusFound)
+	}))
+	defer server.Close()
+
+	u, _ := url.Parse(server.URL + "/abcdef")
+	resolved, err := resolveShortLink(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resolved.Host != "www.bilibili.com" || resolved.Path != "/video/BV1xx411c7mD" {
+		t.Errorf("unexpected url: %s", resolved)
+	}
+}
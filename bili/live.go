@@ -0,0 +1,399 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	pb "proto"
+
+	ffmpeg_go "github.com/u2takey/ffmpeg-go"
+	"google.golang.org/protobuf/proto"
+)
+
+const liveBase = "https://api.live.bilibili.com"
+
+const (
+	liveRetryInterval  = 5 * time.Second // 断流后重连间隔
+	liveOfflineTimeout = 5 * time.Minute // 下播超过该时间后结束录制
+)
+
+// 直播间信息
+type liveRoomData struct {
+	RoomInfo struct {
+		RoomID     int    `json:"room_id"`
+		Title      string `json:"title"`
+		Cover      string `json:"cover"`
+		LiveStatus int    `json:"live_status"` // 1:直播中
+	} `json:"room_info"`
+	AnchorInfo struct {
+		BaseInfo struct {
+			Uname string `json:"uname"`
+		} `json:"base_info"`
+	} `json:"anchor_info"`
+}
+
+// 直播流信息
+type livePlayData struct {
+	RoomID      int `json:"room_id"`
+	LiveStatus  int `json:"live_status"`
+	PlayurlInfo struct {
+		Playurl struct {
+			GQnDesc []struct {
+				Qn   int    `json:"qn"`
+				Desc string `json:"desc"`
+			} `json:"g_qn_desc"`
+			Stream []struct {
+				ProtocolName string `json:"protocol_name"` // http_stream/http_hls
+				Format       []struct {
+					FormatName string      `json:"format_name"` // flv/ts/fmp4
+					Codec      []liveCodec `json:"codec"`
+				} `json:"format"`
+			} `json:"stream"`
+		} `json:"playurl"`
+	} `json:"playurl_info"`
+}
+
+type liveCodec struct {
+	CodecName string `json:"codec_name"`
+	CurrentQn int    `json:"current_qn"`
+	AcceptQn  []int  `json:"accept_qn"`
+	BaseURL   string `json:"base_url"`
+	URLInfo   []struct {
+		Host  string `json:"host"`
+		Extra string `json:"extra"`
+	} `json:"url_info"`
+}
+
+// 直播流地址
+type liveStream struct {
+	url    string
+	format string // flv/ts
+	qn     int
+}
+
+func liveURL(roomID int) string {
+	return "https://live.bilibili.com/" + strconv.Itoa(roomID)
+}
+
+// 获取直播间信息, 短号会转换为真实房间号
+func fetchLiveRoom(sessdata string, roomID int) (*liveRoomData, error) {
+	room, err := apiGet[liveRoomData](sessdata, liveBase+"/xlive/web-room/v1/index/getInfoByRoom", map[string]string{
+		"room_id": strconv.Itoa(roomID),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("获取直播间信息失败, err: %w", err)
+	}
+	return room, nil
+}
+
+func fetchLivePlay(sessdata string, roomID, qn int) (*livePlayData, error) {
+	return apiGet[livePlayData](sessdata, liveBase+"/xlive/web-room/v2/index/getRoomPlayInfo", map[string]string{
+		"room_id":  strconv.Itoa(roomID),
+		"protocol": "0,1",
+		"format":   "0,1,2",
+		"codec":    "0,1",
+		"qn":       strconv.Itoa(qn),
+		"platform": "web",
+		"ptype":    "8",
+	})
+}
+
+// 可选画质
+func (p *livePlayData) formats() []*pb.Format {
+	accepted := map[int]bool{}
+	for _, stream := range p.PlayurlInfo.Playurl.Stream {
+		for _, format := range stream.Format {
+			for _, codec := range format.Codec {
+				for _, qn := range codec.AcceptQn {
+					accepted[qn] = true
+				}
+			}
+		}
+	}
+
+	formats := make([]*pb.Format, 0)
+	for _, desc := range p.PlayurlInfo.Playurl.GQnDesc {
+		if !accepted[desc.Qn] {
+			continue
+		}
+		formats = append(formats, &pb.Format{
+			Id:       int64(desc.Qn),
+			MimeType: "live",
+			Label:    desc.Desc,
+			Code:     "flv",
+		})
+	}
+	return formats
+}
+
+// 选择直播流, 优先 flv, 其次 hls(ts)
+func (p *livePlayData) stream() (*liveStream, bool) {
+	for _, want := range []struct{ protocol, format string }{
+		{"http_stream", "flv"},
+		{"http_hls", "ts"},
+	} {
+		for _, stream := range p.PlayurlInfo.Playurl.Stream {
+			if stream.ProtocolName != want.protocol {
+				continue
+			}
+			for _, format := range stream.Format {
+				if format.FormatName != want.format {
+					continue
+				}
+				for _, codec := range format.Codec {
+					// hevc 兼容性较差, 仅在没有 avc 时使用
+					if codec.CodecName != "avc" && len(format.Codec) > 1 {
+						continue
+					}
+					if len(codec.URLInfo) == 0 {
+						continue
+					}
+					info := codec.URLInfo[0]
+					return &liveStream{
+						url:    info.Host + codec.BaseURL + info.Extra,
+						format: want.format,
+						qn:     codec.CurrentQn,
+					}, true
+				}
+			}
+		}
+	}
+	return nil, false
+}
+
+// 直播任务, 默认选择最高画质
+func (s *server) parseLive(task *pb.Task, roomID int, sessdata string) (*pb.Task, error) {
+	play, err := fetchLivePlay(sessdata, roomID, 10000)
+	if err != nil {
+		return nil, fmt.Errorf("获取数据失败, err: %s", err.Error())
+	}
+	if play.LiveStatus != 1 {
+		return nil, errors.New("直播间未开播")
+	}
+
+	formats := play.formats()
+	if len(formats) > 0 {
+		formats[0].Selected = true
+	}
+
+	newTask := proto.Clone(task).(*pb.Task)
+	newTask.Segments = []*pb.Segment{{MimeType: "live", Formats: formats}}
+	return newTask, nil
+}
+
+// 直播录制, 按时长分段, 断流后自动重连
+type liveRecorder struct {
+	j       *Job
+	roomID  int
+	qn      int
+	started time.Time
+	written atomic.Int64
+	files   []string
+}
+
+func (r *liveRecorder) run() error {
+	ctx, cancel := r.j.context()
+	defer cancel()
+
+	r.started = time.Now()
+	go r.report(ctx)
+
+	offlineSince := time.Time{}
+	for ctx.Err() == nil {
+		stream, err := r.fetchStream()
+		if err != nil {
+			if offlineSince.IsZero() {
+				offlineSince = time.Now()
+			}
+			if time.Since(offlineSince) > liveOfflineTimeout {
+				break
+			}
+			fmt.Printf("获取直播流失败, err: %s\n", err.Error())
+			sleepContext(ctx, liveRetryInterval)
+			continue
+		}
+		offlineSince = time.Time{}
+
+		if err := r.recordSegment(ctx, stream); err != nil && ctx.Err() == nil {
+			// 断流, 稍后重连并写入新文件
+			fmt.Printf("直播录制中断, err: %s\n", err.Error())
+			sleepContext(ctx, liveRetryInterval)
+		}
+	}
+
+	if len(r.files) == 0 {
+		return errors.New("录制失败, 没有获取到直播流")
+	}
+	r.j.task.Filepath = r.files[len(r.files)-1]
+	return nil
+}
+
+func (r *liveRecorder) fetchStream() (*liveStream, error) {
+	play, err := fetchLivePlay(r.j.config.sessdata, r.roomID, r.qn)
+	if err != nil {
+		return nil, err
+	}
+	if play.LiveStatus != 1 {
+		return nil, errors.New("直播间未开播")
+	}
+
+	stream, ok := play.stream()
+	if !ok {
+		return nil, errors.New("没有可用的直播流")
+	}
+	return stream, nil
+}
+
+// 录制一个分段, 到达分段时长、断流或停止时结束
+func (r *liveRecorder) recordSegment(parent context.Context, stream *liveStream) error {
+	ctx, cancel := context.WithTimeout(parent, r.j.config.liveSegment)
+	defer cancel()
+
+	path := filepath.Join(r.j.task.WorkDir,
+		sanitizeFileName(r.j.task.Title)+"_"+time.Now().Format("20060102_150405")+"."+stream.format)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	var err error
+	if stream.format == "flv" {
+		err = r.recordFLV(ctx, stream.url, path)
+	} else {
+		err = r.recordHLS(ctx, stream.url, path)
+	}
+
+	// 只保留有内容的分段
+	if info, statErr := os.Stat(path); statErr == nil && info.Size() > 0 {
+		r.files = append(r.files, path)
+	} else {
+		os.Remove(path)
+	}
+
+	// 到达分段时长或停止时正常结束
+	if ctx.Err() != nil {
+		return nil
+	}
+	if err == nil {
+		err = io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+func (r *liveRecorder) recordFLV(ctx context.Context, url, path string) error {
+	resp, err := newRequest("").
+		SetContext(ctx).
+		SetHeader("Referer", "https://live.bilibili.com/").
+		SetDoNotParseResponse(true).
+		Get(url)
+	if err != nil {
+		return err
+	}
+	body := resp.RawBody()
+	defer body.Close()
+
+	if resp.StatusCode() != http.StatusOK {
+		return fmt.Errorf("请求失败: %s", resp.Status())
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = io.Copy(file, &countingReader{reader: body, count: &r.written})
+	return err
+}
+
+// hls 使用 ffmpeg 拉流
+func (r *liveRecorder) recordHLS(ctx context.Context, url, path string) error {
+	ffmpeg, ok := ffmpegPath(r.j.config)
+	if !ok {
+		return errors.New("录制 hls 直播流需要 ffmpeg")
+	}
+
+	out := ffmpeg_go.Input(url, ffmpeg_go.KwArgs{
+		"headers": "Referer: https://live.bilibili.com/\r\n",
+	}).Output(path, ffmpeg_go.KwArgs{"c": "copy"}).
+		GlobalArgs("-loglevel", "error")
+	out.Context = ctx
+	out = out.OverWriteOutput().SetFfmpegPath(ffmpeg)
+
+	// ffmpeg 写入的文件大小计入已录制字节数
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		var last int64
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if info, err := os.Stat(path); err == nil {
+					r.written.Add(info.Size() - last)
+					last = info.Size()
+				}
+			}
+		}
+	}()
+
+	return out.Run()
+}
+
+// 回报录制时长与大小
+func (r *liveRecorder) report(ctx context.Context) {
+	notify := NewDownloadNotification(r.j.stream)
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	var last int64
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			written := r.written.Load()
+			notify.OnUpdate(&pb.Task{
+				Status: "录制中 " + formatElapsed(time.Since(r.started)),
+				Cover:  r.j.task.Cover,
+				Size:   written,
+				Speed:  written - last,
+			})
+			last = written
+		}
+	}
+}
+
+type countingReader struct {
+	reader io.Reader
+	count  *atomic.Int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.reader.Read(p)
+	c.count.Add(int64(n))
+	return n, err
+}
+
+// e.g. 01:02:03
+func formatElapsed(d time.Duration) string {
+	seconds := int(d.Seconds())
+	return fmt.Sprintf("%02d:%02d:%02d", seconds/3600, seconds/60%60, seconds%60)
+}
+
+func sleepContext(ctx context.Context, d time.Duration) {
+	select {
+	case <-ctx.Done():
+	case <-time.After(d):
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	pb "proto"
+)
+
+const livePlayJSON = `{
+	"room_id": 22637261,
+	"live_status": 1,
+	"playurl_info": {"playurl": {
+		"g_qn_desc": [{"qn": 10000, "desc": "原画"}, {"qn": 400, "desc": "蓝光"}, {"qn": 150, "desc": "高清"}],
+		"stream": [
+			{"protocol_name": "http_hls", "format": [{"format_name": "ts", "codec": [
+				{"codec_name": "avc", "current_qn": 10000, "accept_qn": [10000, 150], "base_url": "/live/index.m3u8?", "url_info": [{"host": "https://hls.example.com", "extra": "token=1"}]}
+			]}]},
+			{"protocol_name": "http_stream", "format": [{"format_name": "flv", "codec": [
+				{"codec_name": "hevc", "current_qn": 10000, "accept_qn": [10000], "base_url": "/live/hevc.flv?", "url_info": [{"host": "https://flv.example.com", "extra": "token=2"}]},
+				{"codec_name": "avc", "current_qn": 10000, "accept_qn": [10000, 150], "base_url": "/live/avc.flv?", "url_info": [{"host": "https://flv.example.com", "extra": "token=3"}]}
+			]}]}
+		]
+	}}
+}`
+
+func TestLivePlayStream(t *testing.T) {
+	var play livePlayData
+	if err := json.Unmarshal([]byte(livePlayJSON), &play); err != nil {
+		t.Fatal(err)
+	}
+
+	formats := play.formats()
+	if len(formats) != 2 || formats[0].Id != 10000 || formats[1].Id != 150 {
+		t.Errorf("unexpected formats: %v", formats)
+	}
+
+	stream, ok := play.stream()
+	if !ok {
+		t.Fatal("no stream")
+	}
+	if stream.format != "flv" || stream.url != "https://flv.example.com/live/avc.flv?token=3" {
+		t.Errorf("unexpected stream: %+v", stream)
+	}
+}
+
+func TestLiveRecordSegment(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("FLV\x01"))
+	}))
+	defer server.Close()
+
+	c := NewConfig()
+	c.liveSegment = time.Minute
+	task := newTask("直播", liveURL(1), "1", "")
+	task.WorkDir = t.TempDir()
+
+	r := &liveRecorder{j: &Job{config: c, task: task}}
+	err := r.recordSegment(context.Background(), &liveStream{url: server.URL, format: "flv"})
+	if err == nil {
+		t.Error("expected error when stream ends")
+	}
+
+	if len(r.files) != 1 || filepath.Ext(r.files[0]) != ".flv" {
+		t.Fatalf("unexpected files: %v", r.files)
+	}
+	if data, _ := os.ReadFile(r.files[0]); string(data) != "FLV\x01" {
+		t.Errorf("unexpected content: %q", data)
+	}
+	if r.written.Load() != 4 {
+		t.Errorf("got %d bytes written", r.written.Load())
+	}
+}
+
+func TestNewJobLive(t *testing.T) {
+	task := newTask("直播", liveURL(1), "1", "")
+	task.Segments = []*pb.Segment{{MimeType: "live", Formats: []*pb.Format{
+		{Id: 10000, MimeType: "live", Label: "原画"},
+		{Id: 150, MimeType: "live", Label: "高清", Selected: true},
+	}}}
+
+	job, err := NewJob(nil, task, NewConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.downloadVideo || job.downloadAudio {
+		t.Errorf("live job should not download video or audio")
+	}
+	if job.live == nil || job.live.Id != 150 {
+		t.Errorf("unexpected live format: %v", job.live)
+	}
+}
+
+func TestFormatElapsed(t *testing.T) {
+	if got := formatElapsed(time.Hour + 2*time.Minute + 3*time.Second); got != "01:02:03" {
+		t.Errorf("got %s", got)
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	pb "proto"
+
+	qrcode "github.com/skip2/go-qrcode"
+	empty "google.golang.org/protobuf/types/known/emptypb"
+)
+
+const (
+	passportBase     = "https://passport.bilibili.com"
+	loginQRExpire    = 180 * time.Second // 二维码有效期
+	loginPollPeriod  = 2 * time.Second   // 轮询间隔
+	loginQRImageSize = 256
+)
+
+// 扫码状态码
+const (
+	qrCodeConfirmed = 0
+	qrCodeExpired   = 86038
+	qrCodeScanned   = 86090
+	qrCodeWaiting   = 86101
+)
+
+// 登录后需要保存的 cookie
+var loginCookieNames = []string{"SESSDATA", "bili_jct", "DedeUserID", "DedeUserID__ckMd5", "sid"}
+
+type qrGenerateData struct {
+	URL       string `json:"url"`
+	QrcodeKey string `json:"qrcode_key"`
+}
+
+type qrPollData struct {
+	URL          string `json:"url"` // 登录成功时包含 cookie 参数
+	RefreshToken string `json:"refresh_token"`
+	Code         int    `json:"code"`
+	Message      string `json:"message"`
+}
+
+// 开始扫码登录, 返回二维码图片与轮询 key
+func (s *server) BeginLogin(ctx context.Context, i *empty.Empty) (*pb.LoginResponse, error) {
+	data, err := apiGet[qrGenerateData]("", passportBase+"/x/passport-login/web/qrcode/generate", nil)
+	if err != nil {
+		return nil, fmt.Errorf("获取登录二维码失败, err: %w", err)
+	}
+
+	image, err := qrcode.Encode(data.URL, qrcode.Medium, loginQRImageSize)
+	if err != nil {
+		return nil, fmt.Errorf("生成登录二维码失败, err: %w", err)
+	}
+
+	resp := &pb.LoginResponse{
+		Key:       data.QrcodeKey,
+		Url:       data.URL,
+		Image:     image,
+		ExpiresIn: int64(loginQRExpire.Seconds()),
+	}
+
+	// 同时保存到临时目录, 方便宿主直接展示
+	if s.config.tmpDir != "" {
+		path := filepath.Join(s.config.tmpDir, "login", data.QrcodeKey+".png")
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err == nil {
+			if err := os.WriteFile(path, image, 0644); err == nil {
+				resp.Filepath = path
+			}
+		}
+	}
+	return resp, nil
+}
+
+// 轮询扫码状态, 状态变化时推送, 确认或过期后结束
+// 网络错误时继续重试, 直到二维码过期
+func (s *server) PollLogin(lr *pb.LoginRequest, stream pb.DownloadService_PollLoginServer) error {
+	ctx, cancel := context.WithTimeout(stream.Context(), loginQRExpire+loginPollPeriod)
+	defer cancel()
+
+	last := pb.LoginState_State(-1)
+	for {
+		state, err := pollLogin(lr.Key)
+		if err != nil {
+			// 接口返回的错误不会自行恢复, 风控拦截除外
+			var apiErr *apiError
+			if errors.As(err, &apiErr) && apiErr.code != -412 {
+				return err
+			}
+			fmt.Printf("查询扫码状态失败, 稍后重试, err: %s\n", err.Error())
+		} else {
+			if state.State != last {
+				last = state.State
+				if err := stream.Send(state); err != nil {
+					return err
+				}
+			}
+			if state.State == pb.LoginState_CONFIRMED || state.State == pb.LoginState_EXPIRED {
+				return nil
+			}
+		}
+
+		sleepContext(ctx, loginPollPeriod)
+		if ctx.Err() != nil {
+			if stream.Context().Err() != nil {
+				return stream.Context().Err()
+			}
+			return stream.Send(&pb.LoginState{State: pb.LoginState_EXPIRED, Message: "二维码已过期"})
+		}
+	}
+}
+
+func pollLogin(key string) (*pb.LoginState, error) {
+	resp, err := newRequest("").
+		SetQueryParam("qrcode_key", key).
+		Get(passportBase + "/x/passport-login/web/qrcode/poll")
+	if err != nil {
+		return nil, fmt.Errorf("查询扫码状态失败, err: %w", err)
+	}
+	result, err := decodeAPI[qrPollData](resp)
+	if err != nil {
+		return nil, err
+	}
+	return result.Data.state(resp.Cookies()), nil
+}
+
+func (d *qrPollData) state(cookies []*http.Cookie) *pb.LoginState {
+	state := &pb.LoginState{Message: d.Message}
+	switch d.Code {
+	case qrCodeConfirmed:
+		state.State = pb.LoginState_CONFIRMED
+		state.Cookies = loginCookies(cookies, d.URL)
+		state.RefreshToken = d.RefreshToken
+	case qrCodeScanned:
+		state.State = pb.LoginState_SCANNED
+	case qrCodeExpired:
+		state.State = pb.LoginState_EXPIRED
+	default:
+		state.State = pb.LoginState_WAITING
+	}
+	return state
+}
+
+// 优先使用响应头中的 cookie, 缺少时从跳转链接参数中读取
+func loginCookies(cookies []*http.Cookie, link string) map[string]string {
+	result := make(map[string]string)
+	for _, c := range cookies {
+		result[c.Name] = c.Value
+	}
+
+	if u, err := url.Parse(link); err == nil {
+		query := u.Query()
+		for _, name := range loginCookieNames {
+			if _, ok := result[name]; !ok && query.Get(name) != "" {
+				result[name] = query.Get(name)
+			}
+		}
+	}
+	return result
+}
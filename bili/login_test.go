@@ -0,0 +1,42 @@
+package main
+
+import (
+	"net/http"
+	pb "proto"
+	"testing"
+)
+
+func TestLoginState(t *testing.T) {
+	cases := []struct {
+		code int
+		want pb.LoginState_State
+	}{
+		{qrCodeWaiting, pb.LoginState_WAITING},
+		{qrCodeScanned, pb.LoginState_SCANNED},
+		{qrCodeExpired, pb.LoginState_EXPIRED},
+		{qrCodeConfirmed, pb.LoginState_CONFIRMED},
+	}
+	for _, c := range cases {
+		data := &qrPollData{Code: c.code}
+		if got := data.state(nil).State; got != c.want {
+			t.Errorf("code %d: got %s, want %s", c.code, got, c.want)
+		}
+	}
+}
+
+func TestLoginCookies(t *testing.T) {
+	data := &qrPollData{
+		Code:         qrCodeConfirmed,
+		URL:          "https://passport.biligame.com/x/passport-login/web/crossDomain?DedeUserID=1&SESSDATA=from-url&bili_jct=jct",
+		RefreshToken: "token",
+	}
+	cookies := []*http.Cookie{{Name: "SESSDATA", Value: "from-header"}}
+
+	state := data.state(cookies)
+	if state.Cookies["SESSDATA"] != "from-header" || state.Cookies["bili_jct"] != "jct" || state.Cookies["DedeUserID"] != "1" {
+		t.Errorf("unexpected cookies: %v", state.Cookies)
+	}
+	if state.RefreshToken != "token" {
+		t.Errorf("got refresh token %q", state.RefreshToken)
+	}
+}
@@ -10,15 +10,14 @@ import (
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 
 	pb "proto"
 
 	bv "github.com/Yuelioi/bilibili/pkg/endpoints/video"
 
-	"github.com/Yuelioi/bilibili/pkg/bpi"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/health"
 	"google.golang.org/grpc/health/grpc_health_v1"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/protobuf/proto"
@@ -28,9 +27,10 @@ import (
 type server struct {
 	pb.UnimplementedDownloadServiceServer
 	tq         *JobManager
-	service    *bpi.BpiService
 	grpcServer *grpc.Server
 	config     *Config
+	health     *healthServer
+	watchLater *watchLaterTracker // 稍后再看中等待下载的分P
 }
 
 // 初始化
@@ -47,8 +47,10 @@ func (s *server) Update(ctx context.Context, i *empty.Empty) (*empty.Empty, erro
 		sessdata := md.Get("plugin.sessdata")
 		if len(sessdata) > 0 {
 			s.config.sessdata = sessdata[0]
-			s.service.Client.SESSDATA = sessdata[0]
-			fmt.Printf("sessdata: %v\n", sessdata[0])
+			// 账号信息通过响应头返回给宿主
+			if account := s.checkAccount(sessdata[0]); account != nil {
+				grpc.SetHeader(ctx, account.metadata())
+			}
 		}
 
 		ffmpeg := md.Get("system.ffmpeg")
@@ -62,6 +64,140 @@ func (s *server) Update(ctx context.Context, i *empty.Empty) (*empty.Empty, erro
 			fmt.Printf("tmps: %v\n", tmps[0])
 			s.config.tmpDir = tmps[0]
 		}
+
+		if v, ok := mdValue(md, "plugin.stream_formats"); ok {
+			s.config.fnval = parseFnval(splitList(v))
+		}
+
+		if v, ok := mdValue(md, "plugin.select_quality"); ok {
+			// best 或最大分辨率 e.g. 1080
+			height, _ := strconv.Atoi(strings.TrimSuffix(strings.ToLower(v), "p"))
+			s.config.selection.maxHeight = height
+		}
+
+		if v, ok := mdValue(md, "plugin.select_codecs"); ok && len(splitList(v)) > 0 {
+			s.config.selection.codecs = splitList(v)
+		}
+
+		if v, ok := mdValue(md, "plugin.select_smallest"); ok {
+			s.config.selection.smallest = v == "true"
+		}
+
+		if v, ok := mdValue(md, "plugin.season_scope"); ok {
+			s.config.seasonScope = v
+		}
+
+		if v, ok := mdValue(md, "plugin.space_since"); ok {
+			s.config.spaceFilter.since = parseDate(v)
+		}
+
+		if v, ok := mdValue(md, "plugin.space_until"); ok {
+			s.config.spaceFilter.until = parseDate(v)
+		}
+
+		if v, ok := mdValue(md, "plugin.space_min_duration"); ok {
+			s.config.spaceFilter.minDuration, _ = strconv.Atoi(v)
+		}
+
+		if v, ok := mdValue(md, "plugin.space_keyword"); ok {
+			s.config.spaceFilter.keyword = v
+		}
+
+		if v, ok := mdValue(md, "plugin.space_tid"); ok {
+			s.config.spaceFilter.tid, _ = strconv.Atoi(v)
+		}
+
+		if v, ok := mdValue(md, "plugin.live_segment_minutes"); ok {
+			if minutes, err := strconv.Atoi(v); err == nil && minutes > 0 {
+				s.config.liveSegment = time.Duration(minutes) * time.Minute
+			}
+		}
+
+		if v, ok := mdValue(md, "plugin.bili_jct"); ok {
+			s.config.biliJct = v
+		}
+
+		if v, ok := mdValue(md, "plugin.accounts"); ok {
+			s.config.accounts = parseAccounts(v)
+		}
+
+		if v, ok := mdValue(md, "plugin.watchlater_remove"); ok {
+			s.config.watchLaterRemove = v == "true"
+		}
+
+		if v, ok := mdValue(md, "plugin.history_limit"); ok {
+			if limit, err := strconv.Atoi(v); err == nil && limit > 0 {
+				s.config.historyLimit = limit
+			}
+		}
+
+		if v, ok := mdValue(md, "plugin.cdn_policy"); ok {
+			s.config.cdn.mode = v
+		}
+
+		if v, ok := mdValue(md, "plugin.cdn_hosts"); ok && len(splitList(v)) > 0 {
+			s.config.cdn.hosts = splitList(v)
+		}
+
+		if v, ok := mdValue(md, "plugin.cdn_race"); ok {
+			s.config.cdnRace = v == "true"
+		}
+
+		if v, ok := mdValue(md, "plugin.download_video"); ok {
+			s.config.downloadVideo = v == "true"
+		}
+
+		if v, ok := mdValue(md, "plugin.download_audio"); ok {
+			s.config.downloadAudio = v == "true"
+		}
+
+		if v, ok := mdValue(md, "plugin.audio_format"); ok && isAudioFormat(v) {
+			s.config.audioFormat = v
+		}
+
+		if v, ok := mdValue(md, "plugin.download_subtitle"); ok {
+			s.config.downloadSubtitle = v == "true"
+		}
+
+		if v, ok := mdValue(md, "plugin.subtitle_format"); ok && (v == "srt" || v == "ass") {
+			s.config.subtitleFormat = v
+		}
+
+		if v, ok := mdValue(md, "plugin.mux_subtitle"); ok {
+			s.config.muxSubtitle = v == "true"
+		}
+
+		if v, ok := mdValue(md, "plugin.download_danmaku"); ok {
+			s.config.downloadDanmaku = v == "true"
+		}
+
+		if v, ok := mdValue(md, "plugin.danmaku_font_size"); ok {
+			if size, err := strconv.Atoi(v); err == nil && size > 0 {
+				s.config.danmakuFontSize = size
+			}
+		}
+
+		if v, ok := mdValue(md, "plugin.danmaku_opacity"); ok {
+			if opacity, err := strconv.ParseFloat(v, 64); err == nil && opacity >= 0 && opacity <= 1 {
+				s.config.danmakuOpacity = opacity
+			}
+		}
+
+		if v, ok := mdValue(md, "plugin.danmaku_duration"); ok {
+			if duration, err := strconv.ParseFloat(v, 64); err == nil && duration > 0 {
+				s.config.danmakuDuration = duration
+			}
+		}
+
+		if v, ok := mdValue(md, "plugin.danmaku_density"); ok {
+			if density, err := strconv.Atoi(v); err == nil && density >= 0 {
+				s.config.danmakuDensity = density
+			}
+		}
+
+		if v, ok := mdValue(md, "plugin.danmaku_keywords"); ok {
+			s.config.danmakuKeywords = splitList(v)
+		}
 		return &empty.Empty{}, nil
 	}
 	return &empty.Empty{}, errors.New("主机未提供相应参数")
@@ -79,43 +215,210 @@ func (s *server) Shutdown(ctx context.Context, i *empty.Empty) (*empty.Empty, er
 }
 
 func (s *server) GetInfo(ctx context.Context, sr *pb.InfoRequest) (*pb.InfoResponse, error) {
-	aid, bvid := extractAidBvid(sr.Url)
-	vInfo, err := s.service.Video().Info(aid, bvid)
+	link, err := normalizeURL(sr.Url)
+	if err != nil {
+		return nil, err
+	}
+
+	target := classifyURL(link)
+
+	switch target.kind {
+	// 番剧
+	case linkBangumi:
+		season, err := fetchSeason(s.config.sessdata, target.sub, target.id)
+		if err != nil {
+			return nil, err
+		}
+
+		resp := &pb.InfoResponse{
+			Title:     season.Title,
+			Cover:     season.Cover,
+			Author:    season.UpInfo.Uname,
+			Tasks:     season.tasks(),
+			NeedParse: true,
+		}
+		return s.withLocalCover(resp)
+
+	// 课堂
+	case linkCheese:
+		course, err := fetchCourse(s.config.sessdata, target.sub, target.id)
+		if err != nil {
+			return nil, err
+		}
+
+		resp := &pb.InfoResponse{
+			Title:     course.Title,
+			Cover:     course.Cover,
+			Author:    course.UpInfo.Uname,
+			Tasks:     course.tasks(),
+			NeedParse: true,
+		}
+		return s.withLocalCover(resp)
+
+	// 收藏夹
+	case linkFavorites:
+		favorites, err := fetchFavorites(s.config.sessdata, target.id)
+		if err != nil {
+			return nil, err
+		}
+
+		resp := &pb.InfoResponse{
+			Title:     favorites.Info.Title,
+			Cover:     favorites.Info.Cover,
+			Author:    favorites.Info.Upper.Name,
+			Tasks:     s.favoritesTasks(favorites),
+			NeedParse: true,
+		}
+		return s.withLocalCover(resp)
+
+	// UP 主投稿
+	case linkSpace:
+		videos, err := fetchSpaceVideos(s.config.sessdata, target.id, s.config.spaceFilter.withQuery(link))
+		if err != nil {
+			return nil, err
+		}
+
+		if len(videos) == 0 {
+			return nil, errors.New("没有符合条件的投稿")
+		}
+
+		title := videos[0].Author + " 的投稿"
+		resp := &pb.InfoResponse{
+			Title:     title,
+			Cover:     videos[0].Pic,
+			Author:    videos[0].Author,
+			Tasks:     spaceTasks(videos, title),
+			NeedParse: true,
+		}
+		return s.withLocalCover(resp)
+
+	// 音频区歌曲与歌单
+	case linkAudio:
+		if target.sub == "am" {
+			menu, songs, err := fetchMenu(s.config.sessdata, target.id)
+			if err != nil {
+				return nil, err
+			}
+
+			resp := &pb.InfoResponse{
+				Title:     menu.Title,
+				Cover:     menu.Cover,
+				Author:    menu.Uname,
+				Tasks:     menuTasks(menu, songs),
+				NeedParse: true,
+			}
+			return s.withLocalCover(resp)
+		}
+
+		song, err := fetchSong(s.config.sessdata, target.id)
+		if err != nil {
+			return nil, err
+		}
+
+		resp := &pb.InfoResponse{
+			Title:     song.Title,
+			Cover:     song.Cover,
+			Author:    song.Author,
+			Tasks:     []*pb.Task{newTask(song.Title, songURL(song.ID), strconv.Itoa(song.ID), song.Cover)},
+			NeedParse: true,
+		}
+		return s.withLocalCover(resp)
+
+	// 直播间
+	case linkLive:
+		room, err := fetchLiveRoom(s.config.sessdata, target.id)
+		if err != nil {
+			return nil, err
+		}
+
+		roomID := room.RoomInfo.RoomID
+		resp := &pb.InfoResponse{
+			Title:     room.RoomInfo.Title,
+			Cover:     room.RoomInfo.Cover,
+			Author:    room.AnchorInfo.BaseInfo.Uname,
+			Tasks:     []*pb.Task{newTask(room.RoomInfo.Title, liveURL(roomID), strconv.Itoa(roomID), room.RoomInfo.Cover)},
+			NeedParse: true,
+		}
+		return s.withLocalCover(resp)
+
+	// 稍后再看
+	case linkWatchLater:
+		archives, err := fetchWatchLater(s.config.sessdata)
+		if err != nil {
+			return nil, err
+		}
+		return s.archiveInfo(archives, watchLaterSeries, linkWatchLater)
+
+	// 历史记录
+	case linkHistory:
+		archives, err := fetchHistory(s.config.sessdata, s.config.historyLimit)
+		if err != nil {
+			return nil, err
+		}
+		return s.archiveInfo(archives, "历史记录", linkHistory)
+
+	// 视频
+	case linkVideo, linkPage:
+	default:
+		return nil, fmt.Errorf("暂不支持该类型链接: %s", target.kind)
+	}
+
+	view, err := fetchView(s.config.sessdata, target.aid, target.bvid)
 	if err != nil {
 		return nil, err
 	}
 
 	resp := &pb.InfoResponse{
-		Title:     vInfo.Data.Title,
-		Cover:     vInfo.Data.Pic,
-		Author:    vInfo.Data.Owner.Name,
-		Tasks:     make([]*pb.Task, 0),
+		Title:     view.Title,
+		Cover:     view.Pic,
+		Author:    view.Owner.Name,
+		Tasks:     view.tasks(),
 		NeedParse: true,
 	}
 
-	if vInfo.Data.IsSeasonDisplay {
-		for _, episode := range vInfo.Data.UgcSeason.Sections[0].Episodes {
-			resp.Tasks = append(resp.Tasks, newTask(
-				episode.Title,
-				"https://www.bilibili.com/video/av"+strconv.Itoa(episode.AID),
-				strconv.Itoa(episode.CID),
-				episode.Arc.Pic,
-			))
+	// 互动视频按剧情图展开
+	if view.Rights.IsSteinGate == 1 {
+		graph, err := fetchStoryGraph(s.config.sessdata, view)
+		if err != nil {
+			return nil, err
 		}
-	} else {
-		for _, page := range vInfo.Data.Pages {
-			resp.Tasks = append(resp.Tasks, newTask(
-				page.Part,
-				"https://www.bilibili.com/video/av"+strconv.Itoa(vInfo.Data.AID)+"?p="+strconv.Itoa(page.Page),
-				strconv.Itoa(page.CID),
-				page.FirstFrame,
-			))
+		if err := graph.save(storyGraphCachePath(s.config.tmpDir, view.Bvid)); err != nil {
+			fmt.Printf("缓存剧情图失败, err: %s\n", err.Error())
 		}
+		resp.Tasks = graph.tasks(view.Pic)
+		return s.withLocalCover(resp)
+	}
+
+	// 合集默认下载全部视频, 宿主可按请求指定范围
+	if view.IsSeasonDisplay && view.UgcSeason != nil && seasonScopeFrom(ctx, s.config.seasonScope) != seasonScopeVideo {
+		resp.Title = view.UgcSeason.Title
+		resp.Cover = view.UgcSeason.Cover
+		resp.Tasks = view.UgcSeason.tasks()
+	}
+
+	return s.withLocalCover(resp)
+}
+
+// 稍后再看与历史记录的任务信息, 使用第一个视频的封面
+func (s *server) archiveInfo(archives []listedArchive, title string, source linkKind) (*pb.InfoResponse, error) {
+	if len(archives) == 0 {
+		return nil, fmt.Errorf("%s为空", title)
+	}
+
+	resp := &pb.InfoResponse{
+		Title:     title,
+		Cover:     archives[0].Pic,
+		Tasks:     s.archiveTasks(archives, title, source),
+		NeedParse: true,
 	}
+	return s.withLocalCover(resp)
+}
 
+// 下载封面到临时目录, 主机需要本地文件路径
+func (s *server) withLocalCover(resp *pb.InfoResponse) (*pb.InfoResponse, error) {
 	suffix := filepath.Ext(resp.Cover)
 	tmpCoverPath := filepath.Join(s.config.tmpDir, "cover", timestamp()+suffix)
-	err = downloadCover(resp.Cover, tmpCoverPath)
+	err := downloadCover(resp.Cover, tmpCoverPath)
 	if err != nil {
 		return nil, err
 	}
@@ -128,100 +431,224 @@ func (s *server) Parse(ctx context.Context, pr *pb.TasksRequest) (*pb.TasksRespo
 	resp := &pb.TasksResponse{}
 
 	for _, task := range pr.Tasks {
-		avid, bvid := extractAidBvid(task.Url)
-		cid, err := strconv.Atoi(task.SessionId)
+		// 使用任务指定的账号, 风控或登录失效时换用其他账号
+		newTask, acc, err := withAccounts(s.config.accountsFor(task.Account), func(acc account) (*pb.Task, error) {
+			return s.parseTask(task, acc.sessdata)
+		})
 		if err != nil {
 			return nil, err
 		}
 
-		if !task.Selected {
-			resp.Tasks = append(resp.Tasks, task)
-			continue
+		// 下载时使用解析成功的账号
+		if newTask.Selected && acc.name != "" {
+			newTask.Account = acc.name
 		}
 
-		segData, err := s.service.Video().Stream(avid, bvid, cid, 0)
-		if err != nil {
-			return nil, err
+		// 记录稍后再看中选中的分P, 全部下载完成后移除
+		if newTask.Source == linkWatchLater.String() {
+			s.watchLater.track(classifyURL(newTask.Url).bvid, newTask.SessionId, newTask.Selected)
 		}
+		resp.Tasks = append(resp.Tasks, newTask)
+	}
+	return resp, nil
+}
 
-		if segData.Code != 0 {
-			return nil, errors.New("获取数据失败")
-		}
+// 使用指定账号解析单个任务
+func (s *server) parseTask(task *pb.Task, sessdata string) (*pb.Task, error) {
+	if !task.Selected {
+		return task, nil
+	}
 
-		// 过滤掉充电视频
-		if segData.Data.AcceptDescription[0] == "试看" {
-			return nil, errors.New("没有观看权限")
+	// 失效的收藏等无法下载, 即使被选中也不解析, 以免影响其他任务
+	if isSkippedTask(task) {
+		skipped := proto.Clone(task).(*pb.Task)
+		skipped.Selected = false
+		return skipped, nil
+	}
+
+	target := classifyURL(task.Url)
+
+	// 投稿列表的任务在解析时获取 cid
+	if task.SessionId == "" {
+		cid, err := fetchCid(sessdata, task.Url)
+		if err != nil {
+			return nil, err
 		}
+		task.SessionId = strconv.Itoa(cid)
+	}
 
-		// 使用 proto.Clone 来进行深拷贝
-		newTask := proto.Clone(task).(*pb.Task)
+	cid, err := strconv.Atoi(task.SessionId)
+	if err != nil {
+		return nil, err
+	}
 
-		// 清空旧的 segment
-		newTask.Segments = make([]*pb.Segment, 0)
+	// 直播间
+	if target.kind == linkLive {
+		return s.parseLive(task, target.id, sessdata)
+	}
 
-		// 处理视频格式
-		videoSeg := &pb.Segment{MimeType: "video"}
-		for _, video := range segData.Data.Dash.Video {
-			format := &pb.Format{
-				MimeType: "video",
-				Label:    bv.VideoQualityMap[video.ID] + " | " + bv.VideoCodecMap[video.Codecid],
-				Code:     bv.VideoCodecMap[video.Codecid],
-				Url:      video.BaseURL,
-			}
-			videoSeg.Formats = append(videoSeg.Formats, format)
+	// 音频区歌曲
+	if target.kind == linkAudio {
+		return s.parseSong(task, target.id, sessdata)
+	}
+
+	var segData *playURLData
+	switch target.kind {
+	case linkBangumi:
+		if target.sub != "ep" {
+			return nil, fmt.Errorf("无效的剧集链接: %s", task.Url)
+		}
+		segData, err = fetchPGCPlayURL(sessdata, target.id, cid, s.config.fnval)
+	case linkCheese:
+		// 未购买时返回独立的错误码, 不再包装
+		if segData, err = fetchCheesePlayURL(sessdata, target.id, cid, s.config.fnval); err != nil {
+			return nil, err
 		}
-		newTask.Segments = append(newTask.Segments, videoSeg)
+	case linkVideo, linkPage:
+		segData, err = fetchPlayURL(sessdata, target.aid, target.bvid, cid, s.config.fnval)
+	default:
+		return nil, fmt.Errorf("不支持的任务链接: %s", task.Url)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("获取数据失败, err: %w", err)
+	}
 
-		// 处理音频格式
-		audioSeg := &pb.Segment{MimeType: "audio"}
-		for _, audio := range segData.Data.Dash.Audio {
-			format := &pb.Format{
-				MimeType: "audio",
-				Label:    bv.AudioQualityMap[audio.ID],
-				Url:      audio.BaseURL,
-			}
-			audioSeg.Formats = append(audioSeg.Formats, format)
+	// 过滤掉充电视频
+	if len(segData.AcceptDescription) > 0 && segData.AcceptDescription[0] == "试看" {
+		return nil, errors.New("没有观看权限")
+	}
+
+	// 使用 proto.Clone 来进行深拷贝
+	newTask := proto.Clone(task).(*pb.Task)
+
+	// 清空旧的 segment
+	newTask.Segments = make([]*pb.Segment, 0)
+	newTask.Duration = segData.Timelength / 1000
+
+	// 处理视频格式
+	videoSeg := &pb.Segment{MimeType: "video"}
+	for _, video := range segData.Dash.Video {
+		format := &pb.Format{
+			Id:         int64(video.ID),
+			MimeType:   "video",
+			Label:      bv.VideoQualityMap[video.ID] + " | " + bv.VideoCodecMap[video.Codecid],
+			Code:       videoCodecs[video.Codecid],
+			Url:        video.BaseURL,
+			BackupUrls: video.BackupURL,
+			Size:       video.estimateSize(newTask.Duration),
+		}
+		videoSeg.Formats = append(videoSeg.Formats, format)
+	}
+	videoSeg.Formats = append(videoSeg.Formats, segData.gatedVideoFormats(sessdata != "")...)
+	newTask.Segments = append(newTask.Segments, videoSeg)
+
+	// 处理音频格式, 包括杜比全景声与 Hi-Res 无损
+	audioSeg := &pb.Segment{MimeType: "audio"}
+	for _, audio := range segData.audioStreams() {
+		format := &pb.Format{
+			Id:         int64(audio.ID),
+			MimeType:   "audio",
+			Label:      audio.label,
+			Code:       audio.code,
+			Url:        audio.BaseURL,
+			BackupUrls: audio.BackupURL,
+			Size:       audio.estimateSize(newTask.Duration),
+		}
+		audioSeg.Formats = append(audioSeg.Formats, format)
+	}
+	newTask.Segments = append(newTask.Segments, audioSeg)
+
+	// 输出格式, 可按任务选择仅下载音频
+	newTask.Segments = append(newTask.Segments, newOutputSegment(s.config))
+
+	// 处理字幕, 每种语言为一个格式
+	if s.config.downloadSubtitle {
+		subtitles, err := fetchSubtitles(sessdata, target.aid, target.bvid, cid)
+		if err == nil && len(subtitles) > 0 {
+			newTask.Segments = append(newTask.Segments, &pb.Segment{
+				MimeType: "subtitle",
+				Formats:  subtitles,
+			})
 		}
-		newTask.Segments = append(newTask.Segments, audioSeg)
+	}
 
-		resp.Tasks = append(resp.Tasks, newTask)
+	// 处理弹幕
+	if s.config.downloadDanmaku {
+		newTask.Segments = append(newTask.Segments, &pb.Segment{
+			MimeType: "danmaku",
+			Formats: []*pb.Format{
+				{MimeType: "danmaku", Label: "ASS 字幕", Code: "ass"},
+				{MimeType: "danmaku", Label: "XML 原始弹幕", Code: "xml"},
+			},
+		})
 	}
-	return resp, nil
+
+	// 预先选择格式, 批量下载时无需逐个选择
+	s.config.selection.apply(newTask)
+
+	return newTask, nil
 }
 
 func (s *server) Download(tr *pb.TaskRequest, stream pb.DownloadService_DownloadServer) error {
 	start := time.Now()
 
-	job, err := NewJob(stream, tr.Task, s.config)
+	// 使用任务指定的账号下载
+	accounts := s.config.accountsFor(tr.Task.Account)
+	job, err := NewJob(stream, tr.Task, s.config.withAccount(accounts[0]))
 	if err != nil {
 		return err
 	}
+	job.accounts = accounts
 
 	chains := []Handler{&CoverDownloader{}, &JobRegister{}}
 
-	if s.config.downloadVideo {
+	if job.downloadVideo {
 		chains = append(chains, &VideoDownloader{})
 	}
 
-	if s.config.downloadAudio {
+	if job.downloadAudio {
 		chains = append(chains, &AudioDownloader{})
 	}
 
-	if s.config.downloadVideo && s.config.downloadAudio {
+	if job.lyric != nil {
+		chains = append(chains, &LyricDownloader{})
+	}
+
+	if job.live != nil {
+		chains = append(chains, &LiveRecorder{})
+	}
+
+	if s.config.downloadSubtitle && len(job.subtitles) > 0 {
+		chains = append(chains, &SubtitleDownloader{})
+	}
+
+	if s.config.downloadDanmaku && job.danmaku != nil {
+		chains = append(chains, &DanmakuDownloader{})
+	}
+
+	if job.downloadVideo && job.downloadAudio {
 		chains = append(chains, &Combiner{})
+	} else if job.downloadAudio {
+		chains = append(chains, &AudioExtractor{})
 	}
 
-	if !(s.config.downloadVideo && s.config.downloadAudio) {
-		if s.config.downloadVideo {
-			job.video.filepath = job.task.Filepath
-		}
+	if job.downloadVideo || job.downloadAudio {
+		chains = append(chains, &MetadataWriter{})
+	}
 
-		if s.config.downloadAudio {
-			pureTitle := sanitizeFileName(tr.Task.Title)
-			job.audio.filepath = filepath.Join(tr.Task.WorkDir, pureTitle+".mp4")
+	// 互动视频在解析时缓存了剧情图
+	if bvid := classifyURL(job.task.Url).bvid; bvid != "" {
+		if _, err := os.Stat(storyGraphCachePath(s.config.tmpDir, bvid)); err == nil {
+			chains = append(chains, &StoryGraphWriter{})
 		}
 	}
 
+	if s.config.watchLaterRemove && job.task.Source == linkWatchLater.String() {
+		chains = append(chains, &WatchLaterRemover{pending: s.watchLater})
+	}
+
+	defer s.tq.RemoveJob(job.task.Id)
+
 	h := createHandlerChain(chains...)
 	err = h.Handle(job, jm)
 	if err != nil {
@@ -239,9 +666,18 @@ func (s *server) Resume(ctx context.Context, pr *pb.TaskRequest) (*pb.TaskRespon
 func (s *server) Stop(ctx context.Context, sr *pb.TaskRequest) (*pb.TaskResponse, error) {
 	id := sr.Id
 
+	job, ok := s.tq.GetJob(id)
+	if !ok {
+		return &pb.TaskResponse{
+			Id: sr.Id,
+		}, fmt.Errorf("task with ID %s not found", id)
+	}
+
+	job.stop()
 	return &pb.TaskResponse{
-		Id: sr.Id,
-	}, fmt.Errorf("task with ID %s not found", id)
+		Id:    sr.Id,
+		State: "stopped",
+	}, nil
 }
 
 func main() {
@@ -258,21 +694,19 @@ func main() {
 
 	grpcServer := grpc.NewServer()
 
+	// 创建健康检查服务, 初始状态为 SERVING
+	healthServer := newHealthServer()
+
 	s := &server{
 		tq:         NewJobManager(),
-		service:    bpi.New(),
 		grpcServer: grpcServer,
 		config:     NewConfig(),
+		health:     healthServer,
+		watchLater: newWatchLaterTracker(),
 	}
 
 	pb.RegisterDownloadServiceServer(grpcServer, s)
 
-	// 创建健康检查服务
-	healthServer := health.NewServer()
-
-	// 设置服务状态为 SERVING
-	healthServer.SetServingStatus("health_check", grpc_health_v1.HealthCheckResponse_SERVING)
-
 	// 注册健康检查服务到 gRPC 服务器
 	grpc_health_v1.RegisterHealthServer(grpcServer, healthServer)
 
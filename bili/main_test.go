@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	pb "proto"
+)
+
+// 本地模拟视频详情与播放地址接口
+func mockAPI(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/x/web-interface/view":
+			w.Write([]byte(`{"code":0,"data":{"bvid":"` + r.URL.Query().Get("bvid") + `","pages":[{"cid":200,"page":1}]}}`))
+		case "/x/player/playurl":
+			w.Write([]byte(`{"code":0,"data":{"timelength":60000,"dash":{
+				"video":[{"id":80,"base_url":"https://example.com/v.m4s","codecid":7,"height":1080}],
+				"audio":[{"id":30280,"base_url":"https://example.com/a.m4s"}]}}}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	base := apiBase
+	apiBase = server.URL
+	t.Cleanup(func() { apiBase = base })
+}
+
+func TestParseSpaceTasks(t *testing.T) {
+	mockAPI(t)
+
+	videos := []spaceVideo{
+		{Bvid: "BV1xx411c7mD", Title: "选中"},
+		{Bvid: "BV1GJ411x7h7", Title: "未选"},
+	}
+	tasks := spaceTasks(videos, "UP")
+	tasks[0].Selected = true
+
+	s := &server{config: NewConfig()}
+	resp, err := s.Parse(context.Background(), &pb.TasksRequest{Tasks: tasks})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Tasks) != 2 {
+		t.Fatalf("got %d tasks", len(resp.Tasks))
+	}
+
+	if got := resp.Tasks[0]; got.SessionId != "200" || got.Segments[0].Formats[0].Url == "" {
+		t.Errorf("selected task not parsed: %+v", got)
+	}
+	if got := resp.Tasks[1]; got != tasks[1] || got.SessionId != "" {
+		t.Errorf("unselected task changed: %+v", got)
+	}
+}
+
+func TestParseSkipsInvalidFavorites(t *testing.T) {
+	mockAPI(t)
+
+	s := &server{config: NewConfig()}
+	favorites := &favoritesData{}
+	favorites.Medias = []favoritesMedia{
+		{ID: 1, Type: 2, Title: "正常", Page: 1, Bvid: "BV1xx411c7mD"},
+		{ID: 2, Type: 2, Title: "已失效视频", Page: 1, Attr: 9, Bvid: "BV1GJ411x7h7"},
+		{ID: 3, Type: 12, Title: "音频", Page: 1},
+	}
+	favorites.Medias[0].Ugc.FirstCid = 200
+
+	tasks := s.favoritesTasks(favorites)
+	for _, task := range tasks {
+		task.Selected = true
+	}
+
+	resp, err := s.Parse(context.Background(), &pb.TasksRequest{Tasks: tasks})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := resp.Tasks[0]; !got.Selected || got.Segments[0].Formats[0].Url == "" {
+		t.Errorf("valid task not parsed: %+v", got)
+	}
+	for _, got := range resp.Tasks[1:] {
+		if got.Selected || !isSkippedTask(got) {
+			t.Errorf("skipped task parsed: %+v", got)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	ffmpeg_go "github.com/u2takey/ffmpeg-go"
+)
+
+// 写入输出文件的元数据
+type mediaMeta struct {
+	title       string
+	artist      string
+	date        string // 上传日期 2006-01-02
+	description string
+	url         string // 来源链接
+	bvid        string
+	cover       string // 本地封面路径
+	album       string // 所属系列
+	lyrics      string
+}
+
+// 根据任务链接获取元数据, 失败时仅保留任务自身信息
+func loadMeta(j *Job) *mediaMeta {
+	meta := &mediaMeta{
+		title: j.task.Title,
+		url:   j.task.Url,
+		cover: j.task.Cover,
+		album: j.task.Series,
+	}
+
+	if j.lyric != nil {
+		meta.lyrics = j.lyric.text
+	}
+
+	target := classifyURL(j.task.Url)
+	if target.kind == linkAudio {
+		if song, err := fetchSong(j.config.sessdata, target.id); err == nil {
+			meta.artist = song.Author
+			if meta.artist == "" {
+				meta.artist = song.Uname
+			}
+			meta.description = song.Intro
+			if song.Passtime > 0 {
+				meta.date = time.Unix(song.Passtime, 0).Format("2006-01-02")
+			}
+		}
+		return meta
+	}
+
+	if target.aid == 0 && target.bvid == "" {
+		return meta
+	}
+
+	view, err := fetchView(j.config.sessdata, target.aid, target.bvid)
+	if err != nil {
+		return meta
+	}
+
+	meta.artist = view.Owner.Name
+	meta.description = view.Desc
+	meta.bvid = view.Bvid
+	if view.Pubdate > 0 {
+		meta.date = time.Unix(view.Pubdate, 0).Format("2006-01-02")
+	}
+	return meta
+}
+
+// 使用 ffmpeg 写入元数据与封面
+func (m *mediaMeta) embedWithFFmpeg(j *Job, path string, hasVideo bool) error {
+	tmpPath := strings.TrimSuffix(path, filepath.Ext(path)) + ".meta.tmp" + filepath.Ext(path)
+
+	input := []*ffmpeg_go.Stream{ffmpeg_go.Input(path)}
+	kwargs := ffmpeg_go.KwArgs{
+		"c":        "copy",
+		"metadata": m.ffmpegMetadata(),
+	}
+
+	ext := filepath.Ext(path)
+	if ext == ".mp3" {
+		kwargs["id3v2_version"] = "3"
+	}
+
+	// ogg 不支持封面流
+	if data, err := os.ReadFile(m.cover); err == nil && ext != ".opus" {
+		if _, err := coverTag(data); err == nil {
+			input = append(input, ffmpeg_go.Input(m.cover))
+
+			// 封面作为最后一路视频流
+			coverStream := "disposition:v:0"
+			if hasVideo {
+				coverStream = "disposition:v:1"
+			}
+			kwargs[coverStream] = "attached_pic"
+		}
+	}
+
+	// 单个输入时需显式保留全部流
+	if len(input) == 1 {
+		kwargs["map"] = "0"
+	}
+
+	out := ffmpeg_go.Output(input, tmpPath, kwargs)
+	if err := j.runFFmpeg(out, "写入元数据"); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+func (m *mediaMeta) ffmpegMetadata() []string {
+	pairs := [][2]string{
+		{"title", m.title},
+		{"artist", m.artist},
+		{"album", m.album},
+		{"date", m.date},
+		{"description", m.description},
+		{"synopsis", m.description},
+		{"comment", m.url},
+		{"episode_id", m.bvid},
+		{"lyrics", m.lyrics},
+	}
+
+	var metadata []string
+	for _, pair := range pairs {
+		if pair[1] != "" {
+			metadata = append(metadata, pair[0]+"="+pair[1])
+		}
+	}
+	return metadata
+}
+
+// 直接写入 mp4 原子, 无需 ffmpeg
+func (m *mediaMeta) embedWithAtoms(path string) error {
+	tags := []mp4Tag{}
+	for _, tag := range []struct{ name, value string }{
+		{"\xa9nam", m.title},
+		{"\xa9ART", m.artist},
+		{"\xa9alb", m.album},
+		{"\xa9day", m.date},
+		{"desc", m.description},
+		{"ldes", m.description},
+		{"\xa9cmt", m.url},
+		{"\xa9lyr", m.lyrics},
+	} {
+		if tag.value != "" {
+			tags = append(tags, textTag(tag.name, tag.value))
+		}
+	}
+
+	if m.bvid != "" {
+		tags = append(tags, freeformTag("bvid", m.bvid))
+	}
+
+	if data, err := os.ReadFile(m.cover); err == nil {
+		if tag, err := coverTag(data); err == nil {
+			tags = append(tags, tag)
+		}
+	}
+	return writeMP4Tags(path, tags)
+}
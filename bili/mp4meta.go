@@ -0,0 +1,294 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// iTunes 风格的 MP4 标签
+type mp4Tag struct {
+	name     string // 原子类型 e.g. "©nam", 自定义标签为 "----"
+	freeform string // 自定义标签名称
+	dataType uint32 // 1:UTF-8 13:JPEG 14:PNG
+	value    []byte
+}
+
+type mp4Box struct {
+	typ       string
+	offset    int64 // 在父级中的偏移
+	size      int64 // 包含头部
+	headerLen int64
+}
+
+const (
+	mp4DataText = 1
+	mp4DataJPEG = 13
+	mp4DataPNG  = 14
+)
+
+// 容器原子, 需要递归查找 stco/co64
+var mp4Containers = map[string]bool{
+	"moov": true, "trak": true, "mdia": true, "minf": true, "stbl": true, "edts": true, "udta": true,
+}
+
+func textTag(name, value string) mp4Tag {
+	return mp4Tag{name: name, dataType: mp4DataText, value: []byte(value)}
+}
+
+func freeformTag(name, value string) mp4Tag {
+	return mp4Tag{name: "----", freeform: name, dataType: mp4DataText, value: []byte(value)}
+}
+
+// 封面标签, 仅支持 jpg/png
+func coverTag(data []byte) (mp4Tag, error) {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xFF, 0xD8, 0xFF}):
+		return mp4Tag{name: "covr", dataType: mp4DataJPEG, value: data}, nil
+	case bytes.HasPrefix(data, []byte("\x89PNG")):
+		return mp4Tag{name: "covr", dataType: mp4DataPNG, value: data}, nil
+	}
+	return mp4Tag{}, errors.New("不支持的封面格式")
+}
+
+// 读取一层原子
+func readMP4Boxes(r io.ReaderAt, start, end int64) ([]mp4Box, error) {
+	var boxes []mp4Box
+	header := make([]byte, 16)
+
+	for offset := start; offset+8 <= end; {
+		if _, err := r.ReadAt(header[:8], offset); err != nil {
+			return nil, err
+		}
+
+		box := mp4Box{
+			typ:       string(header[4:8]),
+			offset:    offset,
+			size:      int64(binary.BigEndian.Uint32(header[:4])),
+			headerLen: 8,
+		}
+
+		switch box.size {
+		case 0:
+			box.size = end - offset
+		case 1:
+			if _, err := r.ReadAt(header[8:16], offset+8); err != nil {
+				return nil, err
+			}
+			box.size = int64(binary.BigEndian.Uint64(header[8:16]))
+			box.headerLen = 16
+		}
+
+		if box.size < box.headerLen || offset+box.size > end {
+			return nil, fmt.Errorf("无效的原子: %q", box.typ)
+		}
+
+		boxes = append(boxes, box)
+		offset += box.size
+	}
+	return boxes, nil
+}
+
+func makeBox(typ string, payloads ...[]byte) []byte {
+	size := 8
+	for _, p := range payloads {
+		size += len(p)
+	}
+
+	buf := make([]byte, 8, size)
+	binary.BigEndian.PutUint32(buf, uint32(size))
+	copy(buf[4:], typ)
+	for _, p := range payloads {
+		buf = append(buf, p...)
+	}
+	return buf
+}
+
+// 带版本号与标志位的原子
+func makeFullBox(typ string, payloads ...[]byte) []byte {
+	return makeBox(typ, append([][]byte{{0, 0, 0, 0}}, payloads...)...)
+}
+
+func makeMetaBox(tags []mp4Tag) []byte {
+	var items [][]byte
+	for _, tag := range tags {
+		dataHeader := make([]byte, 8)
+		binary.BigEndian.PutUint32(dataHeader, tag.dataType)
+		data := makeBox("data", dataHeader, tag.value)
+
+		if tag.name == "----" {
+			items = append(items, makeBox("----",
+				makeFullBox("mean", []byte("com.apple.iTunes")),
+				makeFullBox("name", []byte(tag.freeform)),
+				data,
+			))
+			continue
+		}
+		items = append(items, makeBox(tag.name, data))
+	}
+
+	hdlr := makeFullBox("hdlr",
+		[]byte{0, 0, 0, 0},
+		[]byte("mdirappl"),
+		make([]byte, 8),
+		[]byte{0},
+	)
+	return makeFullBox("meta", hdlr, makeBox("ilst", items...))
+}
+
+// 重建 moov, 替换 udta 中原有的 meta
+func rebuildMoov(moov []byte, tags []mp4Tag) ([]byte, error) {
+	r := bytes.NewReader(moov)
+	children, err := readMP4Boxes(r, 8, int64(len(moov)))
+	if err != nil {
+		return nil, err
+	}
+
+	var payloads [][]byte
+	var udta [][]byte
+
+	for _, child := range children {
+		raw := moov[child.offset : child.offset+child.size]
+		if child.typ != "udta" {
+			payloads = append(payloads, raw)
+			continue
+		}
+
+		items, err := readMP4Boxes(r, child.offset+child.headerLen, child.offset+child.size)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range items {
+			if item.typ != "meta" {
+				udta = append(udta, moov[item.offset:item.offset+item.size])
+			}
+		}
+	}
+
+	udta = append(udta, makeMetaBox(tags))
+	payloads = append(payloads, makeBox("udta", udta...))
+	return makeBox("moov", payloads...), nil
+}
+
+// 平移 moov 中的 chunk 偏移量
+func shiftChunkOffsets(box []byte, start, end int64, after, delta int64) error {
+	r := bytes.NewReader(box)
+	children, err := readMP4Boxes(r, start, end)
+	if err != nil {
+		return err
+	}
+
+	for _, child := range children {
+		payload := child.offset + child.headerLen
+
+		switch {
+		case mp4Containers[child.typ]:
+			if err := shiftChunkOffsets(box, payload, child.offset+child.size, after, delta); err != nil {
+				return err
+			}
+		case child.typ == "stco":
+			count := int64(binary.BigEndian.Uint32(box[payload+4:]))
+			for i := int64(0); i < count; i++ {
+				pos := payload + 8 + i*4
+				value := int64(binary.BigEndian.Uint32(box[pos:]))
+				if value < after {
+					continue
+				}
+				if value+delta > 0xFFFFFFFF {
+					return errors.New("chunk 偏移量溢出")
+				}
+				binary.BigEndian.PutUint32(box[pos:], uint32(value+delta))
+			}
+		case child.typ == "co64":
+			count := int64(binary.BigEndian.Uint32(box[payload+4:]))
+			for i := int64(0); i < count; i++ {
+				pos := payload + 8 + i*8
+				value := int64(binary.BigEndian.Uint64(box[pos:]))
+				if value >= after {
+					binary.BigEndian.PutUint64(box[pos:], uint64(value+delta))
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// 将标签写入 mp4 文件
+func writeMP4Tags(path string, tags []mp4Tag) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+
+	boxes, err := readMP4Boxes(src, 0, info.Size())
+	if err != nil {
+		return err
+	}
+
+	var moovBox *mp4Box
+	for i := range boxes {
+		if boxes[i].typ == "moov" {
+			moovBox = &boxes[i]
+		}
+	}
+	if moovBox == nil {
+		return errors.New("未找到 moov 原子")
+	}
+
+	moov := make([]byte, moovBox.size)
+	if _, err := src.ReadAt(moov, moovBox.offset); err != nil {
+		return err
+	}
+
+	// 统一为 32 位头部
+	if moovBox.headerLen == 16 {
+		moov = makeBox("moov", moov[16:])
+	}
+
+	newMoov, err := rebuildMoov(moov, tags)
+	if err != nil {
+		return err
+	}
+
+	// moov 位于媒体数据之前时, 需要修正 chunk 偏移量
+	moovEnd := moovBox.offset + moovBox.size
+	delta := int64(len(newMoov)) - moovBox.size
+	if delta != 0 {
+		if err := shiftChunkOffsets(newMoov, 8, int64(len(newMoov)), moovEnd, delta); err != nil {
+			return err
+		}
+	}
+
+	tmpPath := path + ".meta.tmp"
+	dst, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(dst, io.NewSectionReader(src, 0, moovBox.offset))
+	if err == nil {
+		_, err = dst.Write(newMoov)
+	}
+	if err == nil {
+		_, err = io.Copy(dst, io.NewSectionReader(src, moovEnd, info.Size()-moovEnd))
+	}
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	src.Close()
+	return os.Rename(tmpPath, path)
+}
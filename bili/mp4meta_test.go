@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// 构造只含一个 chunk 的最小 mp4
+func buildTestMP4(moovFirst bool) []byte {
+	payload := []byte("media-payload")
+	ftyp := makeBox("ftyp", []byte("isom\x00\x00\x02\x00isom"))
+
+	stco := func(offset uint32) []byte {
+		entries := make([]byte, 8)
+		binary.BigEndian.PutUint32(entries, 1)
+		binary.BigEndian.PutUint32(entries[4:], offset)
+		return makeFullBox("stco", entries)
+	}
+	moov := func(offset uint32) []byte {
+		stbl := makeBox("stbl", stco(offset))
+		return makeBox("moov", makeBox("trak", makeBox("mdia", makeBox("minf", stbl))))
+	}
+
+	mdat := makeBox("mdat", payload)
+	if moovFirst {
+		m := moov(0)
+		return bytes.Join([][]byte{ftyp, moov(uint32(len(ftyp) + len(m) + 8)), mdat}, nil)
+	}
+	return bytes.Join([][]byte{ftyp, mdat, moov(uint32(len(ftyp) + 8))}, nil)
+}
+
+// 读取第一个 chunk 偏移量
+func firstChunkOffset(t *testing.T, data []byte) int64 {
+	t.Helper()
+	r := bytes.NewReader(data)
+	start, end := int64(0), int64(len(data))
+	for _, typ := range []string{"moov", "trak", "mdia", "minf", "stbl", "stco"} {
+		boxes, err := readMP4Boxes(r, start, end)
+		if err != nil {
+			t.Fatal(err)
+		}
+		found := false
+		for _, box := range boxes {
+			if box.typ == typ {
+				start, end = box.offset+box.headerLen, box.offset+box.size
+				found = true
+				break
+			}
+		}
+		if !found {
+			t.Fatalf("box %s not found", typ)
+		}
+	}
+	return int64(binary.BigEndian.Uint32(data[start+8:]))
+}
+
+func TestWriteMP4Tags(t *testing.T) {
+	for _, moovFirst := range []bool{true, false} {
+		path := filepath.Join(t.TempDir(), "out.mp4")
+		if err := os.WriteFile(path, buildTestMP4(moovFirst), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		tags := []mp4Tag{textTag("\xa9nam", "标题"), freeformTag("bvid", "BV1xx411c7mD")}
+		if err := writeMP4Tags(path, tags); err != nil {
+			t.Fatalf("moovFirst=%v: %v", moovFirst, err)
+		}
+		// 重复写入应替换原有标签
+		if err := writeMP4Tags(path, tags); err != nil {
+			t.Fatalf("moovFirst=%v: %v", moovFirst, err)
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if n := bytes.Count(data, []byte("ilst")); n != 1 {
+			t.Errorf("moovFirst=%v: got %d ilst boxes, want 1", moovFirst, n)
+		}
+		if !bytes.Contains(data, []byte("BV1xx411c7mD")) || !bytes.Contains(data, []byte("标题")) {
+			t.Errorf("moovFirst=%v: tags not written", moovFirst)
+		}
+
+		offset := firstChunkOffset(t, data)
+		if got := string(data[offset : offset+int64(len("media-payload"))]); got != "media-payload" {
+			t.Errorf("moovFirst=%v: chunk offset points to %q", moovFirst, got)
+		}
+	}
+}
+
+func TestCoverTag(t *testing.T) {
+	if tag, err := coverTag([]byte{0xFF, 0xD8, 0xFF, 0xE0}); err != nil || tag.dataType != mp4DataJPEG {
+		t.Errorf("jpeg: got %v %v", tag.dataType, err)
+	}
+	if tag, err := coverTag([]byte("\x89PNG\r\n")); err != nil || tag.dataType != mp4DataPNG {
+		t.Errorf("png: got %v %v", tag.dataType, err)
+	}
+	if _, err := coverTag([]byte("RIFF....WEBP")); err == nil {
+		t.Error("expected webp to be rejected")
+	}
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	pb "proto"
+
+	"google.golang.org/protobuf/proto"
+)
+
+const musicBase = "https://www.bilibili.com/audio/music-service-c/web"
+
+const menuPageSize = 100
+
+// 音质, 3 为无损
+const songQualityLossless = 3
+
+// 音频区歌曲
+type songData struct {
+	ID       int    `json:"id"`
+	Uname    string `json:"uname"`  // UP 主
+	Author   string `json:"author"` // 歌手
+	Title    string `json:"title"`
+	Cover    string `json:"cover"`
+	Intro    string `json:"intro"`
+	Lyric    string `json:"lyric"` // LRC 歌词链接
+	Duration int64  `json:"duration"`
+	Passtime int64  `json:"passtime"`
+}
+
+// 歌曲播放地址
+type songURLData struct {
+	Type      int           `json:"type"`
+	Size      int64         `json:"size"`
+	Cdns      []string      `json:"cdns"`
+	Qualities []songQuality `json:"qualities"`
+}
+
+type songQuality struct {
+	Type        int    `json:"type"`
+	Desc        string `json:"desc"`
+	Size        int64  `json:"size"`
+	Require     int    `json:"require"`
+	RequireDesc string `json:"requiredesc"`
+}
+
+// 歌词文件
+type lyricTrack struct {
+	url      string
+	filepath string
+	text     string // 下载后的歌词内容, 用于嵌入
+}
+
+// 歌单
+type menuData struct {
+	MenuID int    `json:"menuId"`
+	Title  string `json:"title"`
+	Cover  string `json:"cover"`
+	Intro  string `json:"intro"`
+	Uname  string `json:"uname"`
+}
+
+type menuSongsData struct {
+	CurPage   int        `json:"curPage"`
+	PageCount int        `json:"pageCount"`
+	Data      []songData `json:"data"`
+}
+
+func songURL(sid int) string {
+	return "https://www.bilibili.com/audio/au" + strconv.Itoa(sid)
+}
+
+// 获取歌曲信息
+func fetchSong(sessdata string, sid int) (*songData, error) {
+	song, err := apiGet[songData](sessdata, musicBase+"/song/info", map[string]string{
+		"sid": strconv.Itoa(sid),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("获取歌曲信息失败, err: %w", err)
+	}
+	return song, nil
+}
+
+// 获取歌曲指定音质的地址, 无权限时返回较低音质
+func fetchSongURL(sessdata string, sid, quality int) (*songURLData, error) {
+	return apiGet[songURLData](sessdata, apiBase+"/audio/music-service-c/url", map[string]string{
+		"songid":    strconv.Itoa(sid),
+		"quality":   strconv.Itoa(quality),
+		"privilege": "2",
+		"mid":       "0",
+		"platform":  "android",
+	})
+}
+
+// 获取歌单信息与全部歌曲
+func fetchMenu(sessdata string, amid int) (*menuData, []songData, error) {
+	menu, err := apiGet[menuData](sessdata, musicBase+"/menu/info", map[string]string{
+		"sid": strconv.Itoa(amid),
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("获取歌单失败, err: %w", err)
+	}
+
+	songs := make([]songData, 0)
+	for pn := 1; ; pn++ {
+		page, err := apiGet[menuSongsData](sessdata, musicBase+"/song/of-menu", map[string]string{
+			"sid": strconv.Itoa(amid),
+			"pn":  strconv.Itoa(pn),
+			"ps":  strconv.Itoa(menuPageSize),
+		})
+		if err != nil {
+			return nil, nil, fmt.Errorf("获取歌单失败, err: %w", err)
+		}
+
+		songs = append(songs, page.Data...)
+		if len(page.Data) == 0 || pn >= page.PageCount {
+			return menu, songs, nil
+		}
+	}
+}
+
+// 歌单任务列表
+func menuTasks(menu *menuData, songs []songData) []*pb.Task {
+	tasks := make([]*pb.Task, 0, len(songs))
+	for _, song := range songs {
+		task := newTask(song.Title, songURL(song.ID), strconv.Itoa(song.ID), song.Cover)
+		task.Series = menu.Title
+		tasks = append(tasks, task)
+	}
+	return tasks
+}
+
+// 歌曲可选音质, 按音质从高到低, 无权限的音质没有下载链接
+func fetchSongFormats(sessdata string, sid int) ([]*pb.Format, error) {
+	best, err := fetchSongURL(sessdata, sid, songQualityLossless)
+	if err != nil {
+		return nil, err
+	}
+
+	qualities := best.Qualities
+	sort.Slice(qualities, func(i, j int) bool {
+		return qualities[i].Type > qualities[j].Type
+	})
+
+	formats := make([]*pb.Format, 0, len(qualities))
+	for _, quality := range qualities {
+		data := best
+		if quality.Type != best.Type {
+			// 高于已获取音质时说明没有权限
+			if quality.Type > best.Type {
+				data = nil
+			} else if data, err = fetchSongURL(sessdata, sid, quality.Type); err != nil || data.Type != quality.Type {
+				data = nil
+			}
+		}
+
+		format := &pb.Format{
+			Id:       int64(quality.Type),
+			MimeType: "audio",
+			Label:    quality.Desc,
+			Code:     audioCodecAAC,
+			Size:     quality.Size,
+		}
+		if quality.Type == songQualityLossless {
+			format.Code = audioCodecFLAC
+		}
+
+		if data != nil && len(data.Cdns) > 0 {
+			format.Url = data.Cdns[0]
+			format.BackupUrls = data.Cdns[1:]
+		} else {
+			reason := quality.RequireDesc
+			if reason == "" {
+				reason = "当前不可用"
+			}
+			format.Label += " | " + reason
+		}
+		formats = append(formats, format)
+	}
+	return formats, nil
+}
+
+// 下载歌词并保存为 lrc
+func downloadLyric(track *lyricTrack) error {
+	resp, err := newRequest("").Get(track.url)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode() != http.StatusOK {
+		return fmt.Errorf("请求失败: %s", resp.Status())
+	}
+
+	if err := os.MkdirAll(filepath.Dir(track.filepath), 0755); err != nil {
+		return err
+	}
+	track.text = string(resp.Body())
+	return os.WriteFile(track.filepath, resp.Body(), 0644)
+}
+
+// 解析歌曲任务, 包括音质、输出格式与歌词
+func (s *server) parseSong(task *pb.Task, sid int, sessdata string) (*pb.Task, error) {
+	song, err := fetchSong(sessdata, sid)
+	if err != nil {
+		return nil, err
+	}
+
+	formats, err := fetchSongFormats(sessdata, sid)
+	if err != nil {
+		return nil, fmt.Errorf("获取数据失败, err: %s", err.Error())
+	}
+
+	newTask := proto.Clone(task).(*pb.Task)
+	newTask.Duration = song.Duration
+	newTask.Segments = []*pb.Segment{
+		{MimeType: "audio", Formats: formats},
+		newAudioOutputSegment(s.config),
+	}
+
+	if song.Lyric != "" {
+		newTask.Segments = append(newTask.Segments, &pb.Segment{
+			MimeType: "lyric",
+			Formats: []*pb.Format{
+				{MimeType: "lyric", Label: "LRC 歌词", Code: "lrc", Url: song.Lyric, Selected: true},
+			},
+		})
+	}
+
+	s.config.selection.apply(newTask)
+	return newTask, nil
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	pb "proto"
+)
+
+func TestMenuTasks(t *testing.T) {
+	menu := &menuData{Title: "歌单"}
+	tasks := menuTasks(menu, []songData{{ID: 1234, Title: "歌曲", Cover: "cover.jpg"}})
+
+	if len(tasks) != 1 {
+		t.Fatalf("got %d tasks, want 1", len(tasks))
+	}
+	if tasks[0].Url != "https://www.bilibili.com/audio/au1234" || tasks[0].SessionId != "1234" || tasks[0].Series != "歌单" {
+		t.Errorf("unexpected task: %v", tasks[0])
+	}
+}
+
+func TestNewJobSong(t *testing.T) {
+	c := NewConfig()
+	task := newTask("歌曲", songURL(1234), "1234", "")
+	task.WorkDir = "work"
+	task.Segments = []*pb.Segment{
+		{MimeType: "audio", Formats: []*pb.Format{
+			{Id: 3, MimeType: "audio", Label: "无损 FLAC | 会员专享", Code: audioCodecFLAC},
+			{Id: 2, MimeType: "audio", Label: "高品质 320K", Code: audioCodecAAC, Url: "https://example.com/320.m4a"},
+		}},
+		newAudioOutputSegment(c),
+		{MimeType: "lyric", Formats: []*pb.Format{
+			{MimeType: "lyric", Code: "lrc", Url: "https://example.com/song.lrc", Selected: true},
+		}},
+	}
+
+	job, err := NewJob(nil, task, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.downloadVideo || !job.downloadAudio {
+		t.Errorf("got video=%v audio=%v, want audio only", job.downloadVideo, job.downloadAudio)
+	}
+	if job.audio.url != "https://example.com/320.m4a" {
+		t.Errorf("got audio url %q", job.audio.url)
+	}
+	if task.Filepath != filepath.Join("work", "歌曲.m4a") {
+		t.Errorf("got filepath %q", task.Filepath)
+	}
+	if job.lyric == nil || job.lyric.filepath != filepath.Join("work", "歌曲.lrc") {
+		t.Errorf("unexpected lyric: %+v", job.lyric)
+	}
+}
+
+func TestAudioOutputSegment(t *testing.T) {
+	c := NewConfig()
+	c.ffmpeg = os.Args[0]
+	c.audioFormat = "flac"
+
+	seg := newAudioOutputSegment(c)
+	for _, fm := range seg.Formats {
+		if fm.Code == outputVideo {
+			t.Errorf("unexpected video output")
+		}
+		if fm.Selected != (fm.Code == "flac") {
+			t.Errorf("%s: selected=%v", fm.Code, fm.Selected)
+		}
+	}
+}
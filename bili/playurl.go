@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	pb "proto"
+)
+
+// 视频流信息
+type playURLData struct {
+	Quality           int      `json:"quality"`
+	Timelength        int64    `json:"timelength"` // 毫秒
+	AcceptDescription []string `json:"accept_description"`
+	AcceptQuality     []int    `json:"accept_quality"`
+	SupportFormats    []struct {
+		Quality        int    `json:"quality"`
+		NewDescription string `json:"new_description"`
+		NeedLogin      bool   `json:"need_login"`
+		NeedVip        bool   `json:"need_vip"`
+	} `json:"support_formats"`
+	Dash struct {
+		Duration int64        `json:"duration"`
+		Video    []dashStream `json:"video"`
+		Audio    []dashStream `json:"audio"`
+		Dolby    struct {
+			Type  int          `json:"type"`
+			Audio []dashStream `json:"audio"`
+		} `json:"dolby"`
+		Flac struct {
+			Display bool        `json:"display"`
+			Audio   *dashStream `json:"audio"`
+		} `json:"flac"`
+	} `json:"dash"`
+}
+
+type dashStream struct {
+	ID        int      `json:"id"`
+	BaseURL   string   `json:"base_url"`
+	BackupURL []string `json:"backup_url"`
+	Bandwidth int64    `json:"bandwidth"`
+	MimeType  string   `json:"mime_type"`
+	Codecs    string   `json:"codecs"`
+	Codecid   int      `json:"codecid"`
+	Width     int      `json:"width"`
+	Height    int      `json:"height"`
+}
+
+// 音频流及其标签
+type audioStream struct {
+	dashStream
+	label string
+	code  string
+}
+
+// fnval 标志位
+const (
+	fnvalDash        = 16
+	fnvalHDR         = 64
+	fnval4K          = 128
+	fnvalDolby       = 256 // 杜比音效
+	fnvalDolbyVision = 512
+	fnval8K          = 1024
+	fnvalAV1         = 2048
+)
+
+// 可在设置中开启的格式
+var streamFormatFlags = map[string]int{
+	"hdr":          fnvalHDR,
+	"4k":           fnval4K,
+	"dolby_audio":  fnvalDolby,
+	"dolby_vision": fnvalDolbyVision,
+	"8k":           fnval8K,
+	"av1":          fnvalAV1,
+}
+
+// 根据格式列表计算 fnval, 始终请求 DASH
+func parseFnval(formats []string) int {
+	fnval := fnvalDash
+	for _, format := range formats {
+		fnval |= streamFormatFlags[strings.ToLower(format)]
+	}
+	return fnval
+}
+
+// 音质标签
+var audioQualityLabels = map[int]string{
+	30216: "64K",
+	30232: "132K",
+	30280: "192K",
+	30250: "杜比全景声",
+	30251: "Hi-Res无损",
+}
+
+// 获取视频流
+func fetchPlayURL(sessdata string, aid int, bvid string, cid int, fnval int) (*playURLData, error) {
+	params := map[string]string{
+		"cid":   fmt.Sprint(cid),
+		"fnval": fmt.Sprint(fnval),
+		"fnver": "0",
+		"qn":    "127",
+	}
+	if fnval&fnval4K != 0 {
+		params["fourk"] = "1"
+	}
+	if bvid != "" {
+		params["bvid"] = bvid
+	} else {
+		params["avid"] = fmt.Sprint(aid)
+	}
+	return apiGet[playURLData](sessdata, apiBase+"/x/player/playurl", params)
+}
+
+// 全部音频流, 包括杜比全景声与 Hi-Res 无损
+func (p *playURLData) audioStreams() []audioStream {
+	streams := make([]audioStream, 0)
+
+	if p.Dash.Flac.Audio != nil {
+		streams = append(streams, audioStream{dashStream: *p.Dash.Flac.Audio, code: audioCodecFLAC})
+	}
+
+	for _, audio := range p.Dash.Dolby.Audio {
+		streams = append(streams, audioStream{dashStream: audio, code: audioCodecDolby})
+	}
+
+	for _, audio := range p.Dash.Audio {
+		streams = append(streams, audioStream{dashStream: audio, code: audioCodecAAC})
+	}
+
+	for i := range streams {
+		label, ok := audioQualityLabels[streams[i].ID]
+		if !ok {
+			label = fmt.Sprint(streams[i].ID)
+		}
+		streams[i].label = label + " | " + strings.ToUpper(streams[i].code)
+	}
+	return streams
+}
+
+// 视频支持但当前账号无法获取的清晰度, 标记需要登录或大会员
+func (p *playURLData) gatedVideoFormats(loggedIn bool) []*pb.Format {
+	available := map[int]bool{}
+	for _, video := range p.Dash.Video {
+		available[video.ID] = true
+	}
+
+	formats := make([]*pb.Format, 0)
+	for _, format := range p.SupportFormats {
+		if available[format.Quality] {
+			continue
+		}
+
+		reason := "当前不可用"
+		switch {
+		case format.NeedLogin && !loggedIn:
+			reason = "需要登录"
+		case format.NeedVip:
+			reason = "需要大会员"
+		}
+
+		// 原因只放在标签中, Code 仍表示编码, 此时未知
+		formats = append(formats, &pb.Format{
+			Id:       int64(format.Quality),
+			MimeType: "video",
+			Label:    format.NewDescription + " | " + reason,
+		})
+	}
+	return formats
+}
+
+// 按码率估算大小
+func (s dashStream) estimateSize(duration int64) int64 {
+	return s.Bandwidth * duration / 8
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseFnval(t *testing.T) {
+	if got := parseFnval(nil); got != fnvalDash {
+		t.Errorf("got %d, want %d", got, fnvalDash)
+	}
+	if got := parseFnval([]string{"HDR", "4k", "av1", "unknown"}); got != fnvalDash|fnvalHDR|fnval4K|fnvalAV1 {
+		t.Errorf("got %d", got)
+	}
+	if got := parseFnval([]string{"hdr", "4k", "dolby_audio", "dolby_vision", "8k", "av1"}); got != 4048 {
+		t.Errorf("got %d, want 4048", got)
+	}
+}
+
+func TestGatedVideoFormats(t *testing.T) {
+	data := `{
+		"support_formats": [
+			{"quality": 127, "new_description": "8K 超高清", "need_login": true, "need_vip": true},
+			{"quality": 80, "new_description": "1080P 高清", "need_login": true},
+			{"quality": 32, "new_description": "480P 清晰"}
+		],
+		"dash": {"video": [{"id": 32, "base_url": "https://example.com/480.m4s"}]}
+	}`
+
+	var p playURLData
+	if err := json.Unmarshal([]byte(data), &p); err != nil {
+		t.Fatal(err)
+	}
+
+	formats := p.gatedVideoFormats(false)
+	if len(formats) != 2 {
+		t.Fatalf("got %d formats, want 2", len(formats))
+	}
+	if formats[0].Label != "8K 超高清 | 需要登录" || formats[1].Label != "1080P 高清 | 需要登录" {
+		t.Errorf("got %q, %q", formats[0].Label, formats[1].Label)
+	}
+
+	formats = p.gatedVideoFormats(true)
+	if formats[0].Label != "8K 超高清 | 需要大会员" || formats[1].Label != "1080P 高清 | 当前不可用" {
+		t.Errorf("got %q, %q", formats[0].Label, formats[1].Label)
+	}
+	for _, fm := range formats {
+		if fm.Code != "" || fm.Url != "" {
+			t.Errorf("gated format should not carry codec or url: %v", fm)
+		}
+	}
+}
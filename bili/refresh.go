@@ -0,0 +1,188 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// 链接剩余有效期不足时提前刷新
+const urlExpiryMargin = 2 * time.Minute
+
+var errStreamExpired = errors.New("下载链接已过期")
+
+// 读取链接中的 deadline 参数
+func urlDeadline(link string) (time.Time, bool) {
+	u, err := url.Parse(link)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	deadline, err := strconv.ParseInt(u.Query().Get("deadline"), 10, 64)
+	if err != nil || deadline <= 0 {
+		return time.Time{}, false
+	}
+	return time.Unix(deadline, 0), true
+}
+
+func urlExpired(link string, now time.Time) bool {
+	deadline, ok := urlDeadline(link)
+	return ok && now.Add(urlExpiryMargin).After(deadline)
+}
+
+// 当前下载链接与获取该链接的账号
+func (m *Media) current() (string, string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.url, m.sessdata
+}
+
+// 刷新过期链接, 请求期间不持有锁, 其他分块可以继续使用备用链接
+// 多个分块同时过期时只采用第一个刷新结果
+func (j *Job) renewURL(m *Media, expired string) (string, error) {
+	m.mu.Lock()
+	if m.url != expired {
+		defer m.mu.Unlock()
+		return m.url, nil
+	}
+	m.mu.Unlock()
+
+	links, acc, err := j.fetchStreamURL(m == j.video, m.formatID, m.codec)
+	if err != nil {
+		return "", fmt.Errorf("刷新下载链接失败, err: %w", err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// 其他分块已经刷新或切换过
+	if m.url != expired {
+		return m.url, nil
+	}
+	m.setURLs(j.config.cdn.apply(links))
+	m.sessdata = acc.sessdata
+	return m.url, nil
+}
+
+// 重新解析任务, 获取同一格式的新链接与备用链接, 账号失效时换用其他账号
+func (j *Job) fetchStreamURL(video bool, id int64, code string) ([]string, account, error) {
+	accounts := j.accounts
+	if len(accounts) == 0 {
+		accounts = []account{{sessdata: j.config.sessdata}}
+	}
+
+	return withAccounts(accounts, func(acc account) ([]string, error) {
+		return j.fetchStreamURLWith(acc.sessdata, video, id, code)
+	})
+}
+
+func (j *Job) fetchStreamURLWith(sessdata string, video bool, id int64, code string) ([]string, error) {
+	target := classifyURL(j.task.Url)
+
+	// 音频区歌曲
+	if target.kind == linkAudio {
+		data, err := fetchSongURL(sessdata, target.id, int(id))
+		if err != nil {
+			return nil, err
+		}
+		if int64(data.Type) != id || len(data.Cdns) == 0 {
+			return nil, errors.New("所选音质已不可用")
+		}
+		return data.Cdns, nil
+	}
+
+	cid, err := strconv.Atoi(j.task.SessionId)
+	if err != nil {
+		return nil, err
+	}
+
+	var data *playURLData
+	switch target.kind {
+	case linkBangumi:
+		data, err = fetchPGCPlayURL(sessdata, target.id, cid, j.config.fnval)
+	case linkCheese:
+		data, err = fetchCheesePlayURL(sessdata, target.id, cid, j.config.fnval)
+	case linkVideo, linkPage:
+		data, err = fetchPlayURL(sessdata, target.aid, target.bvid, cid, j.config.fnval)
+	default:
+		return nil, fmt.Errorf("不支持刷新该链接: %s", j.task.Url)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	links := data.streamURL(video, id, code)
+	if len(links) == 0 {
+		return nil, errors.New("所选格式已不可用")
+	}
+	return links, nil
+}
+
+// 查找指定格式的链接, 主链接在前
+func (p *playURLData) streamURL(video bool, id int64, code string) []string {
+	if video {
+		for _, v := range p.Dash.Video {
+			if int64(v.ID) == id && videoCodecs[v.Codecid] == code {
+				return v.urls()
+			}
+		}
+		return nil
+	}
+
+	for _, a := range p.audioStreams() {
+		if int64(a.ID) == id && a.code == code {
+			return a.urls()
+		}
+	}
+	return nil
+}
+
+// 获取文件大小, 链接过期时刷新后重试, 节点出错时切换备用链接
+func (j *Job) mediaLength(m *Media) (int64, error) {
+	if link, _ := m.current(); urlExpired(link, time.Now()) {
+		if _, err := j.renewURL(m, link); err != nil {
+			return 0, err
+		}
+	}
+
+	if j.config.cdnRace {
+		j.raceCDN(m)
+	}
+
+	renewed := false
+	for {
+		link, sessdata := m.current()
+		resp, err := newRequest(sessdata).
+			SetHeader("Range", "bytes=0-").
+			SetDoNotParseResponse(true).
+			Get(link)
+		if err != nil {
+			if m.failover(link) {
+				continue
+			}
+			return 0, err
+		}
+		resp.RawBody().Close()
+
+		switch resp.StatusCode() {
+		case http.StatusOK, http.StatusPartialContent:
+			return strconv.ParseInt(resp.Header().Get("Content-Length"), 10, 64)
+		case http.StatusForbidden, http.StatusNotFound, http.StatusGone:
+			if renewed {
+				return 0, errStreamExpired
+			}
+			renewed = true
+			if _, err := j.renewURL(m, link); err != nil {
+				return 0, err
+			}
+		default:
+			if m.failover(link) {
+				continue
+			}
+			return 0, fmt.Errorf("请求失败: %s", resp.Status())
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	pb "proto"
+)
+
+func TestURLExpired(t *testing.T) {
+	now := time.Unix(1728630000, 0)
+	cases := []struct {
+		link string
+		want bool
+	}{
+		{"https://upos.bilivideo.com/a.m4s?deadline=1728637696", false},
+		{"https://upos.bilivideo.com/a.m4s?deadline=1728630060", true},
+		{"https://upos.bilivideo.com/a.m4s", false},
+		{"https://upos.bilivideo.com/a.m4s?deadline=abc", false},
+	}
+	for _, c := range cases {
+		if got := urlExpired(c.link, now); got != c.want {
+			t.Errorf("urlExpired(%q) = %v, want %v", c.link, got, c.want)
+		}
+	}
+}
+
+func TestStreamURL(t *testing.T) {
+	data := `{"dash": {
+		"video": [
+			{"id": 80, "base_url": "https://v/avc", "codecid": 7},
+			{"id": 80, "base_url": "https://v/hevc", "codecid": 12}
+		],
+		"audio": [{"id": 30280, "base_url": "https://a/aac"}],
+		"flac": {"audio": {"id": 30251, "base_url": "https://a/flac"}}
+	}}`
+
+	var p playURLData
+	if err := json.Unmarshal([]byte(data), &p); err != nil {
+		t.Fatal(err)
+	}
+
+	if links := p.streamURL(true, 80, "hevc"); len(links) != 1 || links[0] != "https://v/hevc" {
+		t.Errorf("got %v", links)
+	}
+	if links := p.streamURL(false, 30251, audioCodecFLAC); len(links) != 1 || links[0] != "https://a/flac" {
+		t.Errorf("got %v", links)
+	}
+	if links := p.streamURL(true, 120, "avc"); links != nil {
+		t.Error("unexpected stream for missing quality")
+	}
+}
+
+func TestDownloadRange(t *testing.T) {
+	content := []byte("0123456789")
+	var expired atomic.Bool
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if expired.Load() {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		var start, end int
+		fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-%d", &start, &end)
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(content)))
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write(content[start : end+1])
+	}))
+	defer server.Close()
+
+	file, err := os.Create(filepath.Join(t.TempDir(), "media"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	j := &Job{config: NewConfig(), stopChan: make(chan struct{})}
+	m := &Media{url: server.URL, file: file, totalBytesRead: &atomic.Int64{}}
+
+	offset := int64(2)
+	if err := j.downloadRange(server.URL, "", &offset, 5, m); err != nil {
+		t.Fatal(err)
+	}
+	if offset != 6 || m.totalBytesRead.Load() != 4 {
+		t.Errorf("got offset %d read %d", offset, m.totalBytesRead.Load())
+	}
+
+	expired.Store(true)
+	offset = 6
+	if err := j.downloadRange(server.URL, "", &offset, 9, m); !errors.Is(err, errStreamExpired) {
+		t.Errorf("got %v, want errStreamExpired", err)
+	}
+	if offset != 6 {
+		t.Errorf("offset moved to %d on expired link", offset)
+	}
+}
+
+func TestContentRangeStart(t *testing.T) {
+	if start, ok := contentRangeStart("bytes 100-199/1000"); !ok || start != 100 {
+		t.Errorf("got %d %v", start, ok)
+	}
+	if _, ok := contentRangeStart(""); ok {
+		t.Error("empty header should not parse")
+	}
+}
+
+func TestRenewURLWithFallbackAccount(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if cookie, err := r.Cookie("SESSDATA"); err != nil || cookie.Value != "vip" {
+			w.Write([]byte(`{"code":-101,"message":"账号未登录"}`))
+			return
+		}
+		w.Write([]byte(`{"code":0,"data":{"dash":{"video":[{"id":80,"base_url":"https://v/new","codecid":7}]}}}`))
+	}))
+	defer server.Close()
+
+	base := apiBase
+	apiBase = server.URL
+	defer func() { apiBase = base }()
+
+	j := &Job{
+		config:   NewConfig(),
+		accounts: []account{{name: "me", sessdata: "expired"}, {name: "vip", sessdata: "vip"}},
+		task:     &pb.Task{Url: "https://www.bilibili.com/video/BV1xx411c7mD", SessionId: "200"},
+	}
+	j.video = &Media{url: "https://v/old", formatID: 80, codec: "avc", sessdata: "expired"}
+
+	link, err := j.renewURL(j.video, "https://v/old")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if current, sessdata := j.video.current(); link != "https://v/new" || current != link || sessdata != "vip" {
+		t.Errorf("got %q %q, want new link with the fallback account", current, sessdata)
+	}
+
+	// 其他分块已经刷新过, 直接使用新链接
+	if link, err := j.renewURL(j.video, "https://v/old"); err != nil || link != "https://v/new" {
+		t.Errorf("got %q, %v", link, err)
+	}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// 链接类型
+type linkKind int
+
+const (
+	linkUnknown    linkKind = iota
+	linkVideo               // 视频 av/BV
+	linkPage                // 视频指定分P
+	linkBangumi             // 番剧 ep/ss/md
+	linkCheese              // 课堂 ep/ss
+	linkFavorites           // 收藏夹
+	linkSpace               // UP 主投稿
+	linkAudio               // 音频 au/am
+	linkLive                // 直播间
+	linkWatchLater          // 稍后再看
+	linkHistory             // 历史记录
+)
+
+var linkKindNames = map[linkKind]string{
+	linkUnknown:    "unknown",
+	linkVideo:      "video",
+	linkPage:       "page",
+	linkBangumi:    "bangumi",
+	linkCheese:     "cheese",
+	linkFavorites:  "favorites",
+	linkSpace:      "space",
+	linkAudio:      "audio",
+	linkLive:       "live",
+	linkWatchLater: "watchlater",
+	linkHistory:    "history",
+}
+
+func (k linkKind) String() string {
+	return linkKindNames[k]
+}
+
+// 链接解析结果
+type linkTarget struct {
+	kind linkKind
+	aid  int
+	bvid string
+	page int    // 分P, 仅 linkPage
+	id   int    // ep/ss/md/收藏夹/mid/au/am/房间号
+	sub  string // ep/ss/md 或 au/am
+}
+
+var (
+	avPathRegex   = regexp.MustCompile(`^av(\d+)$`)
+	bvPathRegex   = regexp.MustCompile(`^BV[0-9A-Za-z]{10}$`)
+	prefixIDRegex = regexp.MustCompile(`^(ep|ss|md|ml|au|am)(\d+)$`)
+	numberRegex   = regexp.MustCompile(`^\d+$`)
+)
+
+// 解析链接, 仅根据域名与路径判断, 查询参数只读取已知字段
+func classifyURL(link string) linkTarget {
+	u, err := url.Parse(strings.TrimSpace(link))
+	if err != nil {
+		return linkTarget{}
+	}
+	if u.Host == "" && !strings.Contains(link, "://") {
+		if u, err = url.Parse("https://" + strings.TrimSpace(link)); err != nil {
+			return linkTarget{}
+		}
+	}
+
+	parts := strings.FieldsFunc(u.Path, func(r rune) bool { return r == '/' })
+	query := u.Query()
+
+	switch strings.ToLower(u.Hostname()) {
+	case "www.bilibili.com", "bilibili.com", "m.bilibili.com":
+		return classifyMain(parts, query)
+	case "space.bilibili.com":
+		return classifySpace(parts, query)
+	case "live.bilibili.com":
+		// e.g. live.bilibili.com/123 live.bilibili.com/h5/123
+		if len(parts) > 0 && parts[0] == "h5" {
+			parts = parts[1:]
+		}
+		if len(parts) == 1 {
+			if id := positiveInt(parts[0]); id > 0 {
+				return linkTarget{kind: linkLive, id: id}
+			}
+		}
+	}
+	return linkTarget{}
+}
+
+func classifyMain(parts []string, query url.Values) linkTarget {
+	// 移动端分享链接 e.g. /s/video/BV...
+	if len(parts) > 0 && parts[0] == "s" {
+		parts = parts[1:]
+	}
+	if len(parts) == 0 {
+		return linkTarget{}
+	}
+
+	switch {
+	case parts[0] == "video" && len(parts) == 2:
+		target := videoTarget(parts[1])
+		if target.kind == linkUnknown {
+			return target
+		}
+		if page := positiveInt(query.Get("p")); page > 0 {
+			target.kind = linkPage
+			target.page = page
+		}
+		return target
+
+	case parts[0] == "bangumi" && len(parts) == 3:
+		sub, id := prefixedID(parts[2])
+		if parts[1] == "play" && (sub == "ep" || sub == "ss") || parts[1] == "media" && sub == "md" {
+			return linkTarget{kind: linkBangumi, sub: sub, id: id}
+		}
+
+	case parts[0] == "cheese" && len(parts) == 3 && parts[1] == "play":
+		if sub, id := prefixedID(parts[2]); sub == "ep" || sub == "ss" {
+			return linkTarget{kind: linkCheese, sub: sub, id: id}
+		}
+
+	case parts[0] == "medialist" && len(parts) == 3 && (parts[1] == "detail" || parts[1] == "play"):
+		if sub, id := prefixedID(parts[2]); sub == "ml" {
+			return linkTarget{kind: linkFavorites, id: id}
+		}
+
+	case parts[0] == "audio" && len(parts) == 2:
+		if sub, id := prefixedID(parts[1]); sub == "au" || sub == "am" {
+			return linkTarget{kind: linkAudio, sub: sub, id: id}
+		}
+
+	case parts[0] == "watchlater" && len(parts) == 1,
+		parts[0] == "list" && len(parts) == 2 && parts[1] == "watchlater":
+		return linkTarget{kind: linkWatchLater}
+
+	case parts[0] == "account" && len(parts) == 2 && parts[1] == "history",
+		parts[0] == "history" && len(parts) == 1:
+		return linkTarget{kind: linkHistory}
+	}
+	return linkTarget{}
+}
+
+func classifySpace(parts []string, query url.Values) linkTarget {
+	if len(parts) == 0 {
+		return linkTarget{}
+	}
+	mid := positiveInt(parts[0])
+	if mid == 0 {
+		return linkTarget{}
+	}
+
+	rest := strings.Join(parts[1:], "/")
+	switch rest {
+	case "", "video", "upload/video":
+		return linkTarget{kind: linkSpace, id: mid}
+	case "favlist":
+		if fid := positiveInt(query.Get("fid")); fid > 0 {
+			return linkTarget{kind: linkFavorites, id: fid}
+		}
+	}
+	return linkTarget{}
+}
+
+// 解析路径中的 av/BV 号
+func videoTarget(part string) linkTarget {
+	if matches := avPathRegex.FindStringSubmatch(part); len(matches) > 1 {
+		if aid := positiveInt(matches[1]); aid > 0 {
+			return linkTarget{kind: linkVideo, aid: aid}
+		}
+	}
+	if bvPathRegex.MatchString(part) {
+		return linkTarget{kind: linkVideo, bvid: part}
+	}
+	return linkTarget{}
+}
+
+// 解析带前缀的 ID e.g. ep123
+func prefixedID(part string) (string, int) {
+	matches := prefixIDRegex.FindStringSubmatch(part)
+	if len(matches) < 3 {
+		return "", 0
+	}
+	id := positiveInt(matches[2])
+	if id == 0 {
+		return "", 0
+	}
+	return matches[1], id
+}
+
+func positiveInt(value string) int {
+	if !numberRegex.MatchString(value) {
+		return 0
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		return 0
+	}
+	return n
+}
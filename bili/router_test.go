@@ -0,0 +1,86 @@
+package main
+
+import "testing"
+
+func TestClassifyURL(t *testing.T) {
+	for _, c := range []struct {
+		link string
+		want linkTarget
+	}{
+		{"https://www.bilibili.com/video/BV1xx411c7mD", linkTarget{kind: linkVideo, bvid: "BV1xx411c7mD"}},
+		{"https://www.bilibili.com/video/av170001/", linkTarget{kind: linkVideo, aid: 170001}},
+		{"https://m.bilibili.com/video/BV1xx411c7mD?p=3", linkTarget{kind: linkPage, bvid: "BV1xx411c7mD", page: 3}},
+		{"https://www.bilibili.com/s/video/BV1xx411c7mD", linkTarget{kind: linkVideo, bvid: "BV1xx411c7mD"}},
+		{"www.bilibili.com/video/BV1xx411c7mD?p=0", linkTarget{kind: linkVideo, bvid: "BV1xx411c7mD"}},
+		{"https://www.bilibili.com/bangumi/play/ep374717", linkTarget{kind: linkBangumi, sub: "ep", id: 374717}},
+		{"https://www.bilibili.com/bangumi/play/ss12548?from=av123", linkTarget{kind: linkBangumi, sub: "ss", id: 12548}},
+		{"https://www.bilibili.com/bangumi/media/md28229233/", linkTarget{kind: linkBangumi, sub: "md", id: 28229233}},
+		{"https://www.bilibili.com/cheese/play/ep1234?query_from=0", linkTarget{kind: linkCheese, sub: "ep", id: 1234}},
+		{"https://www.bilibili.com/cheese/play/ss567", linkTarget{kind: linkCheese, sub: "ss", id: 567}},
+		{"https://space.bilibili.com/4279370/favlist?fid=1052622027&ftype=create", linkTarget{kind: linkFavorites, id: 1052622027}},
+		{"https://www.bilibili.com/medialist/play/ml42", linkTarget{kind: linkFavorites, id: 42}},
+		{"https://space.bilibili.com/4279370/upload/video", linkTarget{kind: linkSpace, id: 4279370}},
+		{"https://www.bilibili.com/audio/au1234", linkTarget{kind: linkAudio, sub: "au", id: 1234}},
+		{"https://www.bilibili.com/audio/am5678", linkTarget{kind: linkAudio, sub: "am", id: 5678}},
+		{"https://live.bilibili.com/22637261?broadcast_type=0", linkTarget{kind: linkLive, id: 22637261}},
+		{"https://live.bilibili.com/h5/22637261", linkTarget{kind: linkLive, id: 22637261}},
+		{"https://www.bilibili.com/watchlater/#/list", linkTarget{kind: linkWatchLater}},
+		{"https://www.bilibili.com/list/watchlater?bvid=BV1xx411c7mD", linkTarget{kind: linkWatchLater}},
+		{"https://www.bilibili.com/account/history", linkTarget{kind: linkHistory}},
+
+		// 查询参数中的 av/BV 号不应被识别
+		{"https://www.bilibili.com/read/cv123?from=av170001", linkTarget{}},
+		{"https://www.bilibili.com/?spm=BV1xx411c7mD", linkTarget{}},
+		{"https://example.com/video/BV1xx411c7mD", linkTarget{}},
+		{"https://www.bilibili.com/video/BV1xx", linkTarget{}},
+		{"https://www.bilibili.com/video/av0", linkTarget{}},
+		{"https://www.bilibili.com/bangumi/play/md1", linkTarget{}},
+		{"https://space.bilibili.com/4279370/favlist", linkTarget{}},
+		{"https://space.bilibili.com/4279370/dynamic", linkTarget{}},
+		{"", linkTarget{}},
+	} {
+		if got := classifyURL(c.link); got != c.want {
+			t.Errorf("%q: got %+v, want %+v", c.link, got, c.want)
+		}
+	}
+}
+
+func FuzzClassifyURL(f *testing.F) {
+	for _, seed := range []string{
+		"https://www.bilibili.com/video/BV1xx411c7mD?p=2",
+		"https://www.bilibili.com/video/av170001",
+		"https://www.bilibili.com/bangumi/play/ep374717",
+		"https://www.bilibili.com/cheese/play/ss567",
+		"https://space.bilibili.com/4279370/favlist?fid=1",
+		"https://space.bilibili.com/4279370",
+		"https://www.bilibili.com/audio/au1234",
+		"https://live.bilibili.com/1",
+		"https://www.bilibili.com/watchlater/",
+		"https://www.bilibili.com/account/history",
+		"://%zz",
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, link string) {
+		target := classifyURL(link)
+		if target.kind == linkUnknown {
+			if target != (linkTarget{}) {
+				t.Fatalf("unknown link with fields: %+v", target)
+			}
+			return
+		}
+
+		switch target.kind {
+		case linkVideo, linkPage:
+			if target.aid <= 0 && target.bvid == "" {
+				t.Fatalf("video without id: %+v", target)
+			}
+		case linkWatchLater, linkHistory:
+		default:
+			if target.id <= 0 {
+				t.Fatalf("%s without id: %+v", target.kind, target)
+			}
+		}
+	})
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"strconv"
+
+	pb "proto"
+
+	"google.golang.org/grpc/metadata"
+)
+
+// 合集下载范围
+const (
+	seasonScopeSeason = "season" // 整个合集
+	seasonScopeVideo  = "video"  // 仅当前视频
+)
+
+// 本次请求的合集范围, 优先使用 GetInfo 元数据中的 plugin.season_scope
+func seasonScopeFrom(ctx context.Context, fallback string) string {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if v, ok := mdValue(md, "plugin.season_scope"); ok && (v == seasonScopeSeason || v == seasonScopeVideo) {
+			return v
+		}
+	}
+	return fallback
+}
+
+// 视频合集
+type ugcSeason struct {
+	ID       int    `json:"id"`
+	Title    string `json:"title"`
+	Cover    string `json:"cover"`
+	Sections []struct {
+		Title    string       `json:"title"`
+		Episodes []ugcEpisode `json:"episodes"`
+	} `json:"sections"`
+}
+
+type ugcEpisode struct {
+	Aid   int    `json:"aid"`
+	Bvid  string `json:"bvid"`
+	Cid   int    `json:"cid"`
+	Title string `json:"title"`
+	Arc   struct {
+		Pic string `json:"pic"`
+	} `json:"arc"`
+	Pages []viewPage `json:"pages"`
+}
+
+// 合集任务列表, 包括全部分节, 多P视频按分P展开
+func (season *ugcSeason) tasks() []*pb.Task {
+	tasks := make([]*pb.Task, 0)
+
+	for _, section := range season.Sections {
+		for _, ep := range section.Episodes {
+			for _, task := range ep.tasks() {
+				task.Series = season.Title
+				task.Section = section.Title
+				tasks = append(tasks, task)
+			}
+		}
+	}
+	return tasks
+}
+
+// 查找视频所在的分节
+func (season *ugcSeason) sectionOf(aid int) string {
+	for _, section := range season.Sections {
+		for _, ep := range section.Episodes {
+			if ep.Aid == aid {
+				return section.Title
+			}
+		}
+	}
+	return ""
+}
+
+func (ep ugcEpisode) tasks() []*pb.Task {
+	if len(ep.Pages) <= 1 {
+		return []*pb.Task{newTask(ep.Title, videoURL(ep.Bvid, 0), strconv.Itoa(ep.Cid), ep.Arc.Pic)}
+	}
+
+	tasks := make([]*pb.Task, 0, len(ep.Pages))
+	for _, page := range ep.Pages {
+		tasks = append(tasks, newTask(
+			ep.Title+" "+page.Part,
+			videoURL(ep.Bvid, page.Page),
+			strconv.Itoa(page.Cid),
+			ep.Arc.Pic,
+		))
+	}
+	return tasks
+}
+
+// 单个视频的分P任务列表
+func (v *viewData) tasks() []*pb.Task {
+	tasks := make([]*pb.Task, 0, len(v.Pages))
+	for _, page := range v.Pages {
+		tasks = append(tasks, newTask(
+			page.Part,
+			videoURL(v.Bvid, page.Page),
+			strconv.Itoa(page.Cid),
+			page.FirstFrame,
+		))
+	}
+
+	if v.IsSeasonDisplay && v.UgcSeason != nil {
+		section := v.UgcSeason.sectionOf(v.Aid)
+		for _, task := range tasks {
+			task.Series = v.UgcSeason.Title
+			task.Section = section
+		}
+	}
+	return tasks
+}
+
+// 视频链接, page 为 0 时不指定分P
+func videoURL(bvid string, page int) string {
+	link := "https://www.bilibili.com/video/" + bvid
+	if page > 0 {
+		link += "?p=" + strconv.Itoa(page)
+	}
+	return link
+}
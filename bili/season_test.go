@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"google.golang.org/grpc/metadata"
+)
+
+const seasonViewJSON = `{
+	"aid": 2,
+	"bvid": "BV1bb",
+	"title": "第二集",
+	"is_season_display": true,
+	"pages": [{"cid": 20, "page": 1, "part": "第二集"}],
+	"ugc_season": {
+		"title": "合集",
+		"sections": [
+			{"title": "第一季", "episodes": [
+				{"aid": 1, "bvid": "BV1aa", "cid": 10, "title": "第一集", "pages": [{"cid": 10, "page": 1, "part": "P1"}]},
+				{"aid": 2, "bvid": "BV1bb", "cid": 20, "title": "第二集", "pages": [{"cid": 20, "page": 1, "part": "第二集"}]}
+			]},
+			{"title": "第二季", "episodes": [
+				{"aid": 3, "bvid": "BV1cc", "cid": 30, "title": "第三集", "pages": [
+					{"cid": 30, "page": 1, "part": "上"},
+					{"cid": 31, "page": 2, "part": "下"}
+				]}
+			]}
+		]
+	}
+}`
+
+func TestUgcSeasonTasks(t *testing.T) {
+	var view viewData
+	if err := json.Unmarshal([]byte(seasonViewJSON), &view); err != nil {
+		t.Fatal(err)
+	}
+
+	tasks := view.UgcSeason.tasks()
+	if len(tasks) != 4 {
+		t.Fatalf("got %d tasks, want 4", len(tasks))
+	}
+
+	last := tasks[3]
+	if last.Title != "第三集 下" || last.SessionId != "31" || last.Url != "https://www.bilibili.com/video/BV1cc?p=2" {
+		t.Errorf("unexpected page task: %v", last)
+	}
+	if last.Series != "合集" || last.Section != "第二季" {
+		t.Errorf("unexpected series/section: %s/%s", last.Series, last.Section)
+	}
+}
+
+func TestViewTasksInSeason(t *testing.T) {
+	var view viewData
+	if err := json.Unmarshal([]byte(seasonViewJSON), &view); err != nil {
+		t.Fatal(err)
+	}
+
+	tasks := view.tasks()
+	if len(tasks) != 1 {
+		t.Fatalf("got %d tasks, want 1", len(tasks))
+	}
+	if tasks[0].SessionId != "20" || tasks[0].Series != "合集" || tasks[0].Section != "第一季" {
+		t.Errorf("unexpected task: %v", tasks[0])
+	}
+}
+
+func TestSeasonScopeFrom(t *testing.T) {
+	if got := seasonScopeFrom(context.Background(), seasonScopeSeason); got != seasonScopeSeason {
+		t.Errorf("got %q without metadata", got)
+	}
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("plugin.season_scope", seasonScopeVideo))
+	if got := seasonScopeFrom(ctx, seasonScopeSeason); got != seasonScopeVideo {
+		t.Errorf("got %q, want request scope", got)
+	}
+
+	ctx = metadata.NewIncomingContext(context.Background(), metadata.Pairs("plugin.season_scope", "invalid"))
+	if got := seasonScopeFrom(ctx, seasonScopeVideo); got != seasonScopeVideo {
+		t.Errorf("got %q, want fallback for invalid scope", got)
+	}
+}
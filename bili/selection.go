@@ -0,0 +1,162 @@
+package main
+
+import (
+	"strings"
+
+	pb "proto"
+)
+
+// 视频编码, 对应 Format.Code
+var videoCodecs = map[int]string{
+	7:  "avc",
+	12: "hevc",
+	13: "av1",
+}
+
+// 清晰度对应的最大高度
+var videoQualityHeights = map[int64]int{
+	6:   240,
+	16:  360,
+	32:  480,
+	64:  720,
+	74:  720,
+	80:  1080,
+	112: 1080,
+	116: 1080,
+	120: 2160,
+	125: 2160,
+	126: 2160,
+	127: 4320,
+}
+
+// 音质排序, 越大越好
+var audioQualityRanks = map[int64]int{
+	30216: 1,
+	30232: 2,
+	30280: 3,
+	30250: 4,
+	30251: 5,
+}
+
+// 主机未选择格式时的自动选择策略
+type selectionPolicy struct {
+	maxHeight int      // 最大分辨率高度, 0 为不限制
+	codecs    []string // 编码优先级 e.g. avc,hevc,av1
+	smallest  bool     // 优先选择最小的文件
+}
+
+func newSelectionPolicy() selectionPolicy {
+	return selectionPolicy{
+		codecs: []string{"avc", "hevc", "av1"},
+	}
+}
+
+// 为未选择格式的片段预先选择
+func (p selectionPolicy) apply(task *pb.Task) {
+	for _, seg := range task.Segments {
+		var selected *pb.Format
+		switch seg.MimeType {
+		case "video":
+			selected = p.selectVideo(seg.Formats)
+		case "audio":
+			selected = p.selectAudio(seg.Formats)
+		default:
+			continue
+		}
+
+		if selected == nil || hasSelected(seg.Formats) {
+			continue
+		}
+		selected.Selected = true
+	}
+}
+
+// 选择视频格式, 默认最高画质, 同画质按编码优先级
+// 没有不超过最大分辨率的格式时, 退而选择最低画质
+func (p selectionPolicy) selectVideo(formats []*pb.Format) *pb.Format {
+	var best, lowest *pb.Format
+	for _, fm := range formats {
+		if fm.Url == "" {
+			continue
+		}
+
+		if lowest == nil || fm.Id < lowest.Id || (fm.Id == lowest.Id && p.codecRank(fm.Code) < p.codecRank(lowest.Code)) {
+			lowest = fm
+		}
+
+		if p.maxHeight > 0 {
+			if height, ok := videoQualityHeights[fm.Id]; ok && height > p.maxHeight {
+				continue
+			}
+		}
+
+		if best == nil || p.betterVideo(fm, best) {
+			best = fm
+		}
+	}
+
+	if best == nil {
+		return lowest
+	}
+	return best
+}
+
+func (p selectionPolicy) betterVideo(a, b *pb.Format) bool {
+	if p.smallest && a.Size != b.Size {
+		return a.Size < b.Size
+	}
+
+	if a.Id != b.Id {
+		if p.smallest {
+			return a.Id < b.Id
+		}
+		return a.Id > b.Id
+	}
+	return p.codecRank(a.Code) < p.codecRank(b.Code)
+}
+
+// 编码优先级, 越小越优先
+func (p selectionPolicy) codecRank(code string) int {
+	for i, codec := range p.codecs {
+		if strings.EqualFold(codec, code) {
+			return i
+		}
+	}
+	return len(p.codecs)
+}
+
+// 选择音频格式, 默认最高音质
+func (p selectionPolicy) selectAudio(formats []*pb.Format) *pb.Format {
+	var best *pb.Format
+	for _, fm := range formats {
+		if fm.Url == "" {
+			continue
+		}
+
+		if best == nil {
+			best = fm
+			continue
+		}
+
+		if p.smallest {
+			if fm.Size < best.Size || fm.Size == best.Size && audioQualityRanks[fm.Id] < audioQualityRanks[best.Id] {
+				best = fm
+			}
+			continue
+		}
+
+		if audioQualityRanks[fm.Id] > audioQualityRanks[best.Id] {
+			best = fm
+		}
+	}
+	return best
+}
+
+func hasSelected(formats []*pb.Format) bool {
+	for _, fm := range formats {
+		if fm.Selected {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"testing"
+
+	pb "proto"
+)
+
+func testVideoFormats() []*pb.Format {
+	return []*pb.Format{
+		{Id: 120, Code: "hevc", Url: "4k-hevc", Size: 400},
+		{Id: 80, Code: "av1", Url: "1080-av1", Size: 150},
+		{Id: 80, Code: "hevc", Url: "1080-hevc", Size: 180},
+		{Id: 80, Code: "avc", Url: "1080-avc", Size: 250},
+		{Id: 32, Code: "avc", Url: "480-avc", Size: 60},
+		{Id: 127, Label: "8K 超高清 | 需要大会员"},
+	}
+}
+
+func TestSelectVideo(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		policy selectionPolicy
+		want   string
+	}{
+		{"best", newSelectionPolicy(), "4k-hevc"},
+		{"max height", selectionPolicy{maxHeight: 1080, codecs: []string{"avc", "hevc", "av1"}}, "1080-avc"},
+		{"codec order", selectionPolicy{maxHeight: 1080, codecs: []string{"av1", "hevc"}}, "1080-av1"},
+		{"smallest", selectionPolicy{smallest: true}, "480-avc"},
+		{"smallest under height", selectionPolicy{maxHeight: 720, smallest: true}, "480-avc"},
+		{"lowest above height", selectionPolicy{maxHeight: 360, codecs: []string{"avc", "hevc", "av1"}}, "480-avc"},
+	} {
+		got := tt.policy.selectVideo(testVideoFormats())
+		if got == nil || got.Url != tt.want {
+			t.Errorf("%s: got %v, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSelectAudio(t *testing.T) {
+	formats := []*pb.Format{
+		{Id: 30216, Url: "64k", Size: 10},
+		{Id: 30280, Url: "192k", Size: 30},
+		{Id: 30251, Url: "flac", Size: 200},
+	}
+
+	if got := newSelectionPolicy().selectAudio(formats); got.Url != "flac" {
+		t.Errorf("best: got %s", got.Url)
+	}
+	if got := (selectionPolicy{smallest: true}).selectAudio(formats); got.Url != "64k" {
+		t.Errorf("smallest: got %s", got.Url)
+	}
+}
+
+func TestSelectionApply(t *testing.T) {
+	task := &pb.Task{Segments: []*pb.Segment{
+		{MimeType: "video", Formats: testVideoFormats()},
+		{MimeType: "audio", Formats: []*pb.Format{
+			{Id: 30280, Url: "192k", Selected: true},
+			{Id: 30251, Url: "flac"},
+		}},
+	}}
+
+	newSelectionPolicy().apply(task)
+
+	if !task.Segments[0].Formats[0].Selected {
+		t.Error("expected best video to be selected")
+	}
+	// 已选择的片段保持不变
+	if !task.Segments[1].Formats[0].Selected || task.Segments[1].Formats[1].Selected {
+		t.Error("expected host selection to be kept")
+	}
+}
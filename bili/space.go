@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	pb "proto"
+)
+
+const spacePageSize = 30
+
+// 投稿列表
+type spaceSearchData struct {
+	List struct {
+		Vlist []spaceVideo `json:"vlist"`
+	} `json:"list"`
+	Page struct {
+		Pn    int `json:"pn"`
+		Ps    int `json:"ps"`
+		Count int `json:"count"`
+	} `json:"page"`
+}
+
+type spaceVideo struct {
+	Aid     int    `json:"aid"`
+	Bvid    string `json:"bvid"`
+	Title   string `json:"title"`
+	Pic     string `json:"pic"`
+	Author  string `json:"author"`
+	Created int64  `json:"created"`
+	Length  string `json:"length"` // e.g. "12:34"
+	Typeid  int    `json:"typeid"`
+}
+
+// 投稿筛选条件
+type spaceFilter struct {
+	since       time.Time // 起始日期, 包含
+	until       time.Time // 结束日期, 包含当天
+	minDuration int       // 最短时长(秒)
+	keyword     string
+	tid         int // 分区
+}
+
+// 链接中的 tid/keyword 覆盖设置中的筛选条件
+func (f spaceFilter) withQuery(link string) spaceFilter {
+	u, err := url.Parse(link)
+	if err != nil {
+		return f
+	}
+
+	query := u.Query()
+	if tid, err := strconv.Atoi(query.Get("tid")); err == nil {
+		f.tid = tid
+	}
+	if keyword := query.Get("keyword"); keyword != "" {
+		f.keyword = keyword
+	}
+	return f
+}
+
+func (f spaceFilter) match(video spaceVideo) bool {
+	created := time.Unix(video.Created, 0)
+	if !f.since.IsZero() && created.Before(f.since) {
+		return false
+	}
+	if !f.until.IsZero() && !created.Before(f.until.AddDate(0, 0, 1)) {
+		return false
+	}
+	if f.minDuration > 0 && parseLength(video.Length) < f.minDuration {
+		return false
+	}
+	return true
+}
+
+// 获取 UP 主投稿, 按发布时间从新到旧
+func fetchSpaceVideos(sessdata string, mid int, filter spaceFilter) ([]spaceVideo, error) {
+	videos := make([]spaceVideo, 0)
+
+	for pn := 1; ; pn++ {
+		params := map[string]string{
+			"mid":     strconv.Itoa(mid),
+			"ps":      strconv.Itoa(spacePageSize),
+			"pn":      strconv.Itoa(pn),
+			"order":   "pubdate",
+			"tid":     strconv.Itoa(filter.tid),
+			"keyword": filter.keyword,
+			// 风控校验参数
+			"dm_img_list":      "[]",
+			"dm_img_str":       "V2ViR0wgMS4wIChPcGVuR0wgRVMgMi4wIENocm9taXVtKQ",
+			"dm_cover_img_str": "QU5HTEUgKEludGVsLCBJbnRlbChSKSBVSEQgR3JhcGhpY3MgNjMwICgweDAwMDAzRTlCKSBEaXJlY3QzRDExIHZzXzVfMCBwc181XzApLCBvciBzaW1pbGFy",
+		}
+
+		page, err := wbiGet[spaceSearchData](sessdata, apiBase+"/x/space/wbi/arc/search", params)
+		if err != nil {
+			return nil, fmt.Errorf("获取投稿失败, err: %w", err)
+		}
+
+		for _, video := range page.List.Vlist {
+			// 早于起始日期, 后续投稿更早
+			if !filter.since.IsZero() && time.Unix(video.Created, 0).Before(filter.since) {
+				return videos, nil
+			}
+			if filter.match(video) {
+				videos = append(videos, video)
+			}
+		}
+
+		if len(page.List.Vlist) == 0 || pn*spacePageSize >= page.Page.Count {
+			return videos, nil
+		}
+	}
+}
+
+// 投稿任务列表, cid 在解析时获取
+func spaceTasks(videos []spaceVideo, series string) []*pb.Task {
+	tasks := make([]*pb.Task, 0, len(videos))
+	for _, video := range videos {
+		task := newTask(video.Title, "https://www.bilibili.com/video/"+video.Bvid, "", video.Pic)
+		task.Series = series
+		tasks = append(tasks, task)
+	}
+	return tasks
+}
+
+// 解析时长 e.g. "1:02:03" "12:34"
+func parseLength(length string) int {
+	seconds := 0
+	for _, part := range strings.Split(length, ":") {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return 0
+		}
+		seconds = seconds*60 + n
+	}
+	return seconds
+}
+
+// 解析日期设置 e.g. 2024-01-31
+func parseDate(value string) time.Time {
+	t, err := time.ParseInLocation("2006-01-02", value, time.Local)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestClassifySpace(t *testing.T) {
+	for link, want := range map[string]int{
+		"https://space.bilibili.com/4279370":                                4279370,
+		"https://space.bilibili.com/4279370/":                               4279370,
+		"https://space.bilibili.com/4279370/video?tid=36":                   4279370,
+		"https://space.bilibili.com/4279370/upload/video":                   4279370,
+		"https://space.bilibili.com/4279370?spm_id_from=333.1007":           4279370,
+		"https://space.bilibili.com/4279370/favlist?fid=1052622027":         0,
+		"https://space.bilibili.com/4279370/channel/collectiondetail?sid=1": 0,
+	} {
+		got := 0
+		if target := classifyURL(link); target.kind == linkSpace {
+			got = target.id
+		}
+		if got != want {
+			t.Errorf("%s: got %d, want %d", link, got, want)
+		}
+	}
+}
+
+func TestParseLength(t *testing.T) {
+	for length, want := range map[string]int{
+		"12:34":   754,
+		"1:02:03": 3723,
+		"00:05":   5,
+		"":        0,
+		"ab:cd":   0,
+	} {
+		if got := parseLength(length); got != want {
+			t.Errorf("%q: got %d, want %d", length, got, want)
+		}
+	}
+}
+
+func TestSpaceFilterMatch(t *testing.T) {
+	filter := spaceFilter{
+		since:       parseDate("2024-01-01"),
+		until:       parseDate("2024-01-31"),
+		minDuration: 60,
+	}
+
+	day := func(value string) int64 {
+		return parseDate(value).Add(12 * time.Hour).Unix()
+	}
+
+	for _, c := range []struct {
+		video spaceVideo
+		want  bool
+	}{
+		{spaceVideo{Created: day("2024-01-15"), Length: "10:00"}, true},
+		{spaceVideo{Created: day("2024-01-31"), Length: "10:00"}, true},
+		{spaceVideo{Created: day("2023-12-31"), Length: "10:00"}, false},
+		{spaceVideo{Created: day("2024-02-01"), Length: "10:00"}, false},
+		{spaceVideo{Created: day("2024-01-15"), Length: "00:30"}, false},
+	} {
+		if got := filter.match(c.video); got != c.want {
+			t.Errorf("%v: got %v, want %v", c.video, got, c.want)
+		}
+	}
+}
+
+func TestSpaceFilterWithQuery(t *testing.T) {
+	filter := spaceFilter{keyword: "设置", tid: 1}.withQuery("https://space.bilibili.com/1/video?tid=36&keyword=教程")
+	if filter.tid != 36 || filter.keyword != "教程" {
+		t.Errorf("unexpected filter: %+v", filter)
+	}
+}
+
+func TestWbiMixinKey(t *testing.T) {
+	got := mixinKey("7cd084941338484aae1ad9425b84077c" + "4932caff0ff746eab6f01bf08b70ac45")
+	if want := "ea1db124af3c7062474693fa704f4ff8"; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestSignWbi(t *testing.T) {
+	signed := signWbi(map[string]string{
+		"foo": "114",
+		"bar": "514",
+		"zab": "1919810",
+	}, "ea1db124af3c7062474693fa704f4ff8", time.Unix(1702204169, 0))
+
+	if signed["wts"] != "1702204169" {
+		t.Errorf("unexpected wts: %s", signed["wts"])
+	}
+	if want := "8f6f2b5b3d485fe1886cec6a0be8c5d4"; signed["w_rid"] != want {
+		t.Errorf("got w_rid %s, want %s", signed["w_rid"], want)
+	}
+}
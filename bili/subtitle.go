@@ -0,0 +1,200 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	pb "proto"
+)
+
+// 字幕轨道
+type subtitleTrack struct {
+	lang     string // 语言代码 e.g. "zh-CN", "ai-zh"
+	label    string // 语言名称
+	url      string
+	filepath string // 转换后的字幕路径
+}
+
+// 播放器信息, 包括字幕列表与互动视频信息
+type playerData struct {
+	Subtitle struct {
+		Subtitles []struct {
+			ID          int64  `json:"id"`
+			Lan         string `json:"lan"`
+			LanDoc      string `json:"lan_doc"`
+			SubtitleURL string `json:"subtitle_url"`
+			AiType      int    `json:"ai_type"`
+		} `json:"subtitles"`
+	} `json:"subtitle"`
+	Interaction struct {
+		GraphVersion int `json:"graph_version"` // 互动视频剧情图版本
+	} `json:"interaction"`
+}
+
+// B站 JSON 字幕
+type subtitleBody struct {
+	Body []subtitleLine `json:"body"`
+}
+
+type subtitleLine struct {
+	From     float64 `json:"from"`
+	To       float64 `json:"to"`
+	Location int     `json:"location"` // 2:底部 8:顶部
+	Content  string  `json:"content"`
+}
+
+// ISO 639-2 语言代码, 用于封装字幕流
+var subtitleLanguageMap = map[string]string{
+	"zh": "chi",
+	"en": "eng",
+	"ja": "jpn",
+	"ko": "kor",
+	"es": "spa",
+	"fr": "fre",
+	"de": "ger",
+	"ru": "rus",
+	"pt": "por",
+	"ar": "ara",
+	"th": "tha",
+	"vi": "vie",
+	"id": "ind",
+}
+
+// 获取 cid 对应的字幕轨道, 包含 AI 字幕
+func fetchSubtitles(sessdata string, aid int, bvid string, cid int) ([]*pb.Format, error) {
+	params := map[string]string{"cid": fmt.Sprint(cid)}
+	if bvid != "" {
+		params["bvid"] = bvid
+	} else {
+		params["aid"] = fmt.Sprint(aid)
+	}
+
+	data, err := apiGet[playerData](sessdata, apiBase+"/x/player/v2", params)
+	if err != nil {
+		return nil, err
+	}
+
+	formats := make([]*pb.Format, 0)
+	for _, sub := range data.Subtitle.Subtitles {
+		// 未登录时 AI 字幕没有链接
+		if sub.SubtitleURL == "" {
+			continue
+		}
+
+		url := sub.SubtitleURL
+		if strings.HasPrefix(url, "//") {
+			url = "https:" + url
+		}
+
+		formats = append(formats, &pb.Format{
+			Id:       sub.ID,
+			MimeType: "subtitle",
+			Label:    sub.LanDoc,
+			Code:     sub.Lan,
+			Url:      url,
+		})
+	}
+	return formats, nil
+}
+
+// 下载字幕并转换为 srt/ass
+func downloadSubtitle(sessdata string, track *subtitleTrack, format, title string) error {
+	resp, err := newRequest(sessdata).Get(track.url)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode() != http.StatusOK {
+		return fmt.Errorf("请求失败: %s", resp.Status())
+	}
+
+	var body subtitleBody
+	if err := json.Unmarshal(resp.Body(), &body); err != nil {
+		return err
+	}
+
+	content := subtitleToSRT(body.Body)
+	if format == "ass" {
+		content = subtitleToASS(body.Body, title)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(track.filepath), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(track.filepath, []byte(content), 0644)
+}
+
+// 封装字幕流时使用的语言代码
+func (t *subtitleTrack) iso639() string {
+	lang := strings.TrimPrefix(t.lang, "ai-")
+	lang, _, _ = strings.Cut(lang, "-")
+	if code, ok := subtitleLanguageMap[lang]; ok {
+		return code
+	}
+	return "und"
+}
+
+func subtitleToSRT(lines []subtitleLine) string {
+	var sb strings.Builder
+	for i, line := range lines {
+		fmt.Fprintf(&sb, "%d\n%s --> %s\n%s\n\n",
+			i+1,
+			formatSubtitleTime(line.From, ",", 3),
+			formatSubtitleTime(line.To, ",", 3),
+			line.Content,
+		)
+	}
+	return sb.String()
+}
+
+func subtitleToASS(lines []subtitleLine, title string) string {
+	var sb strings.Builder
+	sb.WriteString(assHeader(title, "Style: Default,Microsoft YaHei,54,&H00FFFFFF,&H000000FF,&H00000000,&H80000000,0,0,0,0,100,100,0,0,1,2,1,2,20,20,40,1"))
+
+	for _, line := range lines {
+		text := strings.ReplaceAll(line.Content, "\n", `\N`)
+		if line.Location == 8 {
+			text = `{\an8}` + text
+		}
+		fmt.Fprintf(&sb, "Dialogue: 0,%s,%s,Default,,0,0,0,,%s\n",
+			formatSubtitleTime(line.From, ".", 2),
+			formatSubtitleTime(line.To, ".", 2),
+			text,
+		)
+	}
+	return sb.String()
+}
+
+// ass 文件头
+func assHeader(title string, styles ...string) string {
+	var sb strings.Builder
+	sb.WriteString("[Script Info]\n")
+	fmt.Fprintf(&sb, "Title: %s\n", title)
+	sb.WriteString("ScriptType: v4.00+\nPlayResX: 1920\nPlayResY: 1080\nWrapStyle: 2\nScaledBorderAndShadow: yes\n\n")
+	sb.WriteString("[V4+ Styles]\n")
+	sb.WriteString("Format: Name, Fontname, Fontsize, PrimaryColour, SecondaryColour, OutlineColour, BackColour, Bold, Italic, Underline, StrikeOut, ScaleX, ScaleY, Spacing, Angle, BorderStyle, Outline, Shadow, Alignment, MarginL, MarginR, MarginV, Encoding\n")
+	for _, style := range styles {
+		sb.WriteString(style + "\n")
+	}
+	sb.WriteString("\n[Events]\n")
+	sb.WriteString("Format: Layer, Start, End, Style, Name, MarginL, MarginR, MarginV, Effect, Text\n")
+	return sb.String()
+}
+
+// 格式化字幕时间, srt 为 00:00:01,500 ass 为 0:00:01.50
+func formatSubtitleTime(seconds float64, sep string, digits int) string {
+	d := time.Duration(seconds * float64(time.Second)).Round(time.Millisecond)
+	h := d / time.Hour
+	m := d % time.Hour / time.Minute
+	s := d % time.Minute / time.Second
+	ms := d % time.Second / time.Millisecond
+
+	if digits == 2 {
+		return fmt.Sprintf("%d:%02d:%02d%s%02d", h, m, s, sep, ms/10)
+	}
+	return fmt.Sprintf("%02d:%02d:%02d%s%03d", h, m, s, sep, ms)
+}
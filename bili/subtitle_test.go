@@ -0,0 +1,68 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSubtitleToSRT(t *testing.T) {
+	lines := []subtitleLine{
+		{From: 0.5, To: 2.25, Location: 2, Content: "第一行"},
+		{From: 3661, To: 3662.5, Location: 2, Content: "second"},
+	}
+
+	want := "1\n00:00:00,500 --> 00:00:02,250\n第一行\n\n" +
+		"2\n01:01:01,000 --> 01:01:02,500\nsecond\n\n"
+	if got := subtitleToSRT(lines); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestSubtitleToASS(t *testing.T) {
+	lines := []subtitleLine{
+		{From: 1.5, To: 3, Location: 8, Content: "顶部\n换行"},
+	}
+
+	got := subtitleToASS(lines, "标题")
+	if !strings.Contains(got, "Title: 标题") {
+		t.Error("missing title")
+	}
+	want := `Dialogue: 0,0:00:01.50,0:00:03.00,Default,,0,0,0,,{\an8}顶部\N换行`
+	if !strings.Contains(got, want) {
+		t.Errorf("missing dialogue %q in\n%s", want, got)
+	}
+}
+
+func TestSubtitleISO639(t *testing.T) {
+	for lang, want := range map[string]string{
+		"zh-CN": "chi",
+		"ai-zh": "chi",
+		"en-US": "eng",
+		"xx":    "und",
+	} {
+		if got := (&subtitleTrack{lang: lang}).iso639(); got != want {
+			t.Errorf("%s: got %s, want %s", lang, got, want)
+		}
+	}
+}
+
+func TestDownloadSubtitleStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte("<html>403</html>"))
+	}))
+	defer server.Close()
+
+	track := &subtitleTrack{url: server.URL, filepath: filepath.Join(t.TempDir(), "sub.srt")}
+	err := downloadSubtitle("", track, "srt", "标题")
+	if err == nil || !strings.Contains(err.Error(), "403") {
+		t.Errorf("got %v, want status error", err)
+	}
+	if _, err := os.Stat(track.filepath); !os.IsNotExist(err) {
+		t.Error("subtitle file should not be written on error")
+	}
+}
@@ -2,34 +2,17 @@ package main
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	pb "proto"
 	"regexp"
-	"strconv"
 	"strings"
 	"time"
 
 	"github.com/go-resty/resty/v2"
 )
 
-// 提取aid和bvid
-func extractAidBvid(link string) (aid int, bvid string) {
-	aidRegex := regexp.MustCompile(`av(\d+)`)
-	bvidRegex := regexp.MustCompile(`BV\w+`)
-
-	aidMatches := aidRegex.FindStringSubmatch(link)
-	if len(aidMatches) > 1 {
-		aid, _ = strconv.Atoi(aidMatches[1])
-	}
-
-	bvidMatches := bvidRegex.FindStringSubmatch(link)
-	if len(bvidMatches) > 0 {
-		bvid = bvidMatches[0]
-	}
-	return
-}
-
 // 格式化文件名
 func sanitizeFileName(input string) string {
 	re := regexp.MustCompile(`[<>:"/\\|?*\x00-\x1F]`)
@@ -45,6 +28,50 @@ func sanitizeFileName(input string) string {
 	return sanitized
 }
 
+// 移动文件, 跨磁盘时复制后删除
+func moveFile(src, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+
+	in.Close()
+	return os.Remove(src)
+}
+
+// 拆分逗号分隔的列表, 忽略空项
+func splitList(input string) []string {
+	items := make([]string, 0)
+	for _, item := range strings.Split(input, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
 // 获取时间戳
 func timestamp() string {
 	now := time.Now()
@@ -68,11 +95,11 @@ func downloadCover(url, filePath string) error {
 	}
 
 	dir := filepath.Dir(filePath)
-	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+	if err := os.MkdirAll(dir, 0755); err != nil {
 		return fmt.Errorf("failed to create directory: %v", err)
 	}
 
-	return os.WriteFile(filePath, response.Body(), os.ModePerm)
+	return os.WriteFile(filePath, response.Body(), 0644)
 }
 
 func newTask(title, url, sessionId, cover string) *pb.Task {
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+
+	pb "proto"
+)
+
+// 稍后再看任务的系列名, 仅用于展示
+const watchLaterSeries = "稍后再看"
+
+const historyPageSize = 30
+
+// 稍后再看列表
+type watchLaterData struct {
+	Count int             `json:"count"`
+	List  []listedArchive `json:"list"`
+}
+
+// 历史记录
+type historyData struct {
+	Cursor struct {
+		Max    int   `json:"max"`
+		ViewAt int64 `json:"view_at"`
+	} `json:"cursor"`
+	List []struct {
+		Title      string `json:"title"`
+		Cover      string `json:"cover"`
+		AuthorName string `json:"author_name"`
+		Videos     int    `json:"videos"`
+		History    struct {
+			Oid      int    `json:"oid"` // aid
+			Bvid     string `json:"bvid"`
+			Cid      int    `json:"cid"`
+			Page     int    `json:"page"`
+			Business string `json:"business"` // archive:视频
+		} `json:"history"`
+	} `json:"list"`
+}
+
+// 列表中的视频
+type listedArchive struct {
+	Aid    int    `json:"aid"`
+	Bvid   string `json:"bvid"`
+	Cid    int    `json:"cid"`
+	Title  string `json:"title"`
+	Pic    string `json:"pic"`
+	Videos int    `json:"videos"` // 分P数
+	Owner  struct {
+		Name string `json:"name"`
+	} `json:"owner"`
+}
+
+// 获取稍后再看列表
+func fetchWatchLater(sessdata string) ([]listedArchive, error) {
+	if sessdata == "" {
+		return nil, errors.New("稍后再看需要登录")
+	}
+
+	data, err := apiGet[watchLaterData](sessdata, apiBase+"/x/v2/history/toview", nil)
+	if err != nil {
+		return nil, fmt.Errorf("获取稍后再看失败, err: %w", err)
+	}
+	return data.List, nil
+}
+
+// 获取最近的视频历史记录, 最多 limit 条
+func fetchHistory(sessdata string, limit int) ([]listedArchive, error) {
+	if sessdata == "" {
+		return nil, errors.New("历史记录需要登录")
+	}
+
+	archives := make([]listedArchive, 0)
+	params := map[string]string{
+		"ps":   strconv.Itoa(historyPageSize),
+		"type": "archive",
+	}
+
+	for len(archives) < limit {
+		page, err := apiGet[historyData](sessdata, apiBase+"/x/web-interface/history/cursor", params)
+		if err != nil {
+			return nil, fmt.Errorf("获取历史记录失败, err: %w", err)
+		}
+
+		for _, item := range page.List {
+			if item.History.Business != "archive" || len(archives) >= limit {
+				continue
+			}
+			archive := listedArchive{
+				Aid:    item.History.Oid,
+				Bvid:   item.History.Bvid,
+				Cid:    item.History.Cid,
+				Title:  item.Title,
+				Pic:    item.Cover,
+				Videos: item.Videos,
+			}
+			archive.Owner.Name = item.AuthorName
+			archives = append(archives, archive)
+		}
+
+		if len(page.List) == 0 || page.Cursor.Max == 0 {
+			break
+		}
+		params["max"] = strconv.Itoa(page.Cursor.Max)
+		params["view_at"] = strconv.FormatInt(page.Cursor.ViewAt, 10)
+	}
+	return archives, nil
+}
+
+// 列表任务, 多P视频按分P展开, source 标记任务来源
+func (s *server) archiveTasks(archives []listedArchive, series string, source linkKind) []*pb.Task {
+	tasks := make([]*pb.Task, 0)
+
+	for _, archive := range archives {
+		if archive.Videos <= 1 {
+			tasks = append(tasks, newTask(archive.Title, videoURL(archive.Bvid, 0), strconv.Itoa(archive.Cid), archive.Pic))
+			continue
+		}
+
+		view, err := fetchView(s.config.sessdata, archive.Aid, archive.Bvid)
+		if err != nil {
+			fmt.Printf("跳过视频: %s (%s), err: %s\n", archive.Title, archive.Bvid, err.Error())
+			continue
+		}
+		for _, page := range view.Pages {
+			tasks = append(tasks, newTask(
+				archive.Title+" "+page.Part,
+				videoURL(archive.Bvid, page.Page),
+				strconv.Itoa(page.Cid),
+				archive.Pic,
+			))
+		}
+	}
+
+	for _, task := range tasks {
+		task.Series = series
+		task.Source = source.String()
+	}
+	return tasks
+}
+
+// 稍后再看中等待下载的分P, 选中的分P全部完成后才移除视频
+type watchLaterTracker struct {
+	mu      sync.Mutex
+	pending map[string]map[string]bool // bvid -> cid
+}
+
+func newWatchLaterTracker() *watchLaterTracker {
+	return &watchLaterTracker{pending: make(map[string]map[string]bool)}
+}
+
+// 解析时记录选中的分P, 取消选择的分P不再等待
+func (t *watchLaterTracker) track(bvid, cid string, selected bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	pages := t.pending[bvid]
+	if !selected {
+		delete(pages, cid)
+		return
+	}
+	if pages == nil {
+		pages = make(map[string]bool)
+		t.pending[bvid] = pages
+	}
+	pages[cid] = true
+}
+
+// 分P下载完成, 返回该视频选中的分P是否已全部完成
+// 未记录的视频(e.g. 插件重启后)不移除
+func (t *watchLaterTracker) done(bvid, cid string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	pages, ok := t.pending[bvid]
+	if !ok || !pages[cid] {
+		return false
+	}
+	delete(pages, cid)
+	if len(pages) > 0 {
+		return false
+	}
+	delete(t.pending, bvid)
+	return true
+}
+
+// 从稍后再看中移除, 需要 bili_jct
+func removeWatchLater(sessdata, csrf string, aid int) error {
+	if csrf == "" {
+		return errors.New("未设置 bili_jct")
+	}
+
+	resp, err := newRequest(sessdata).
+		SetCookie(&http.Cookie{Name: "bili_jct", Value: csrf}).
+		SetFormData(map[string]string{
+			"aid":  strconv.Itoa(aid),
+			"csrf": csrf,
+		}).
+		Post(apiBase + "/x/v2/history/toview/del")
+	if err != nil {
+		return err
+	}
+
+	_, err = decodeAPI[json.RawMessage](resp)
+	return err
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestWatchLaterTasks(t *testing.T) {
+	data := `{
+		"count": 1,
+		"list": [{"aid": 170001, "bvid": "BV17x411w7KC", "cid": 279786, "title": "稍后", "pic": "cover.jpg", "videos": 1, "owner": {"name": "UP"}}]
+	}`
+
+	var list watchLaterData
+	if err := json.Unmarshal([]byte(data), &list); err != nil {
+		t.Fatal(err)
+	}
+
+	s := &server{config: NewConfig()}
+	tasks := s.archiveTasks(list.List, watchLaterSeries, linkWatchLater)
+	if len(tasks) != 1 {
+		t.Fatalf("got %d tasks, want 1", len(tasks))
+	}
+	if tasks[0].SessionId != "279786" || tasks[0].Url != "https://www.bilibili.com/video/BV17x411w7KC" || tasks[0].Series != watchLaterSeries || tasks[0].Source != "watchlater" {
+		t.Errorf("unexpected task: %v", tasks[0])
+	}
+}
+
+func TestWatchLaterRequiresLogin(t *testing.T) {
+	if _, err := fetchWatchLater(""); err == nil {
+		t.Error("expected error without SESSDATA")
+	}
+	if _, err := fetchHistory("", 10); err == nil {
+		t.Error("expected error without SESSDATA")
+	}
+	if err := removeWatchLater("sessdata", "", 1); err == nil {
+		t.Error("expected error without bili_jct")
+	}
+}
+
+func TestWatchLaterTracker(t *testing.T) {
+	tracker := newWatchLaterTracker()
+
+	// 只选择了前两P, 第三P未选择
+	tracker.track("BV1xx411c7mD", "1", true)
+	tracker.track("BV1xx411c7mD", "2", true)
+	tracker.track("BV1xx411c7mD", "3", true)
+	tracker.track("BV1xx411c7mD", "3", false)
+
+	if tracker.done("BV1xx411c7mD", "2") {
+		t.Error("removed before all selected pages finished")
+	}
+	if !tracker.done("BV1xx411c7mD", "1") {
+		t.Error("not removed after all selected pages finished")
+	}
+
+	// 已完成或未记录的视频不重复移除
+	if tracker.done("BV1xx411c7mD", "1") || tracker.done("BV1GJ411x7h7", "1") {
+		t.Error("removed untracked video")
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// wbi 签名混淆表
+var mixinKeyEncTab = []int{
+	46, 47, 18, 2, 53, 8, 23, 32, 15, 50, 10, 31, 58, 3, 45, 35, 27, 43, 5, 49,
+	33, 9, 42, 19, 29, 28, 14, 39, 12, 38, 41, 13, 37, 48, 7, 16, 24, 55, 40,
+	61, 26, 17, 0, 1, 60, 51, 30, 4, 22, 25, 54, 21, 56, 59, 6, 63, 57, 62, 11,
+	36, 20, 34, 44, 52,
+}
+
+// wbi 密钥每天更新, 缓存一段时间
+var wbiCache struct {
+	sync.Mutex
+	mixinKey  string
+	updatedAt time.Time
+}
+
+// 获取 wbi 混淆密钥, 未登录时导航接口同样返回密钥
+func wbiMixinKey(sessdata string) (string, error) {
+	wbiCache.Lock()
+	defer wbiCache.Unlock()
+
+	if wbiCache.mixinKey != "" && time.Since(wbiCache.updatedAt) < time.Hour {
+		return wbiCache.mixinKey, nil
+	}
+
+	resp, err := newRequest(sessdata).Get(apiBase + "/x/web-interface/nav")
+	if err != nil {
+		return "", err
+	}
+
+	nav, err := decodeAPI[struct {
+		WbiImg struct {
+			ImgURL string `json:"img_url"`
+			SubURL string `json:"sub_url"`
+		} `json:"wbi_img"`
+	}](resp, -101)
+	if err != nil {
+		return "", err
+	}
+
+	imgKey := strings.TrimSuffix(path.Base(nav.Data.WbiImg.ImgURL), path.Ext(nav.Data.WbiImg.ImgURL))
+	subKey := strings.TrimSuffix(path.Base(nav.Data.WbiImg.SubURL), path.Ext(nav.Data.WbiImg.SubURL))
+
+	wbiCache.mixinKey = mixinKey(imgKey + subKey)
+	wbiCache.updatedAt = time.Now()
+	return wbiCache.mixinKey, nil
+}
+
+func mixinKey(raw string) string {
+	var sb strings.Builder
+	for _, i := range mixinKeyEncTab {
+		if i < len(raw) {
+			sb.WriteByte(raw[i])
+		}
+	}
+
+	key := sb.String()
+	if len(key) > 32 {
+		key = key[:32]
+	}
+	return key
+}
+
+// 为参数添加 wts 与 w_rid
+func signWbi(params map[string]string, mixinKey string, now time.Time) map[string]string {
+	signed := make(map[string]string, len(params)+2)
+	for k, v := range params {
+		// 过滤 value 中的 "!'()*" 字符
+		signed[k] = strings.Map(func(r rune) rune {
+			if strings.ContainsRune("!'()*", r) {
+				return -1
+			}
+			return r
+		}, v)
+	}
+	signed["wts"] = strconv.FormatInt(now.Unix(), 10)
+
+	keys := make([]string, 0, len(signed))
+	for k := range signed {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	query := make([]string, 0, len(keys))
+	for _, k := range keys {
+		query = append(query, wbiEscape(k)+"="+wbiEscape(signed[k]))
+	}
+
+	hash := md5.Sum([]byte(strings.Join(query, "&") + mixinKey))
+	signed["w_rid"] = hex.EncodeToString(hash[:])
+	return signed
+}
+
+// 与 encodeURIComponent 一致, 空格编码为 %20
+func wbiEscape(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
+
+// 请求需要 wbi 签名的接口
+func wbiGet[T any](sessdata, url string, params map[string]string) (*T, error) {
+	key, err := wbiMixinKey(sessdata)
+	if err != nil {
+		return nil, err
+	}
+	return apiGet[T](sessdata, url, signWbi(params, key, time.Now()))
+}
@@ -20,15 +20,17 @@ import (
 const _ = grpc.SupportPackageIsVersion9
 
 const (
-	DownloadService_Init_FullMethodName     = "/DownloadService/Init"
-	DownloadService_Update_FullMethodName   = "/DownloadService/Update"
-	DownloadService_Shutdown_FullMethodName = "/DownloadService/Shutdown"
-	DownloadService_GetInfo_FullMethodName  = "/DownloadService/GetInfo"
-	DownloadService_Parse_FullMethodName    = "/DownloadService/Parse"
-	DownloadService_Download_FullMethodName = "/DownloadService/Download"
-	DownloadService_Pause_FullMethodName    = "/DownloadService/Pause"
-	DownloadService_Resume_FullMethodName   = "/DownloadService/Resume"
-	DownloadService_Stop_FullMethodName     = "/DownloadService/Stop"
+	DownloadService_Init_FullMethodName       = "/DownloadService/Init"
+	DownloadService_Update_FullMethodName     = "/DownloadService/Update"
+	DownloadService_Shutdown_FullMethodName   = "/DownloadService/Shutdown"
+	DownloadService_GetInfo_FullMethodName    = "/DownloadService/GetInfo"
+	DownloadService_Parse_FullMethodName      = "/DownloadService/Parse"
+	DownloadService_Download_FullMethodName   = "/DownloadService/Download"
+	DownloadService_Pause_FullMethodName      = "/DownloadService/Pause"
+	DownloadService_Resume_FullMethodName     = "/DownloadService/Resume"
+	DownloadService_Stop_FullMethodName       = "/DownloadService/Stop"
+	DownloadService_BeginLogin_FullMethodName = "/DownloadService/BeginLogin"
+	DownloadService_PollLogin_FullMethodName  = "/DownloadService/PollLogin"
 )
 
 // DownloadServiceClient is the client API for DownloadService service.
@@ -53,6 +55,10 @@ type DownloadServiceClient interface {
 	Resume(ctx context.Context, in *TaskRequest, opts ...grpc.CallOption) (*TaskResponse, error)
 	// 停止
 	Stop(ctx context.Context, in *TaskRequest, opts ...grpc.CallOption) (*TaskResponse, error)
+	// 开始扫码登录
+	BeginLogin(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*LoginResponse, error)
+	// 轮询扫码状态
+	PollLogin(ctx context.Context, in *LoginRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[LoginState], error)
 }
 
 type downloadServiceClient struct {
@@ -162,6 +168,35 @@ func (c *downloadServiceClient) Stop(ctx context.Context, in *TaskRequest, opts
 	return out, nil
 }
 
+func (c *downloadServiceClient) BeginLogin(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*LoginResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(LoginResponse)
+	err := c.cc.Invoke(ctx, DownloadService_BeginLogin_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *downloadServiceClient) PollLogin(ctx context.Context, in *LoginRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[LoginState], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &DownloadService_ServiceDesc.Streams[1], DownloadService_PollLogin_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[LoginRequest, LoginState]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type DownloadService_PollLoginClient = grpc.ServerStreamingClient[LoginState]
+
 // DownloadServiceServer is the server API for DownloadService service.
 // All implementations must embed UnimplementedDownloadServiceServer
 // for forward compatibility.
@@ -184,6 +219,10 @@ type DownloadServiceServer interface {
 	Resume(context.Context, *TaskRequest) (*TaskResponse, error)
 	// 停止
 	Stop(context.Context, *TaskRequest) (*TaskResponse, error)
+	// 开始扫码登录
+	BeginLogin(context.Context, *emptypb.Empty) (*LoginResponse, error)
+	// 轮询扫码状态
+	PollLogin(*LoginRequest, grpc.ServerStreamingServer[LoginState]) error
 	mustEmbedUnimplementedDownloadServiceServer()
 }
 
@@ -221,6 +260,12 @@ func (UnimplementedDownloadServiceServer) Resume(context.Context, *TaskRequest)
 func (UnimplementedDownloadServiceServer) Stop(context.Context, *TaskRequest) (*TaskResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Stop not implemented")
 }
+func (UnimplementedDownloadServiceServer) BeginLogin(context.Context, *emptypb.Empty) (*LoginResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method BeginLogin not implemented")
+}
+func (UnimplementedDownloadServiceServer) PollLogin(*LoginRequest, grpc.ServerStreamingServer[LoginState]) error {
+	return status.Errorf(codes.Unimplemented, "method PollLogin not implemented")
+}
 func (UnimplementedDownloadServiceServer) mustEmbedUnimplementedDownloadServiceServer() {}
 func (UnimplementedDownloadServiceServer) testEmbeddedByValue()                         {}
 
@@ -397,6 +442,35 @@ func _DownloadService_Stop_Handler(srv interface{}, ctx context.Context, dec fun
 	return interceptor(ctx, in, info, handler)
 }
 
+func _DownloadService_BeginLogin_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(emptypb.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DownloadServiceServer).BeginLogin(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: DownloadService_BeginLogin_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DownloadServiceServer).BeginLogin(ctx, req.(*emptypb.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _DownloadService_PollLogin_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(LoginRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(DownloadServiceServer).PollLogin(m, &grpc.GenericServerStream[LoginRequest, LoginState]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type DownloadService_PollLoginServer = grpc.ServerStreamingServer[LoginState]
+
 // DownloadService_ServiceDesc is the grpc.ServiceDesc for DownloadService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -436,6 +510,10 @@ var DownloadService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "Stop",
 			Handler:    _DownloadService_Stop_Handler,
 		},
+		{
+			MethodName: "BeginLogin",
+			Handler:    _DownloadService_BeginLogin_Handler,
+		},
 	},
 	Streams: []grpc.StreamDesc{
 		{
@@ -443,6 +521,11 @@ var DownloadService_ServiceDesc = grpc.ServiceDesc{
 			Handler:       _DownloadService_Download_Handler,
 			ServerStreams: true,
 		},
+		{
+			StreamName:    "PollLogin",
+			Handler:       _DownloadService_PollLogin_Handler,
+			ServerStreams: true,
+		},
 	},
 	Metadata: "downloader.proto",
 }